@@ -0,0 +1,292 @@
+package tcpover
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tiechui1994/tcpover/rules"
+	"github.com/tiechui1994/tcpover/transport/control"
+	"github.com/tiechui1994/tcpover/transport/statistic"
+	"github.com/tiechui1994/tool/log"
+	"github.com/tiechui1994/tool/util"
+)
+
+// SetAdminSecret set the secret of admin api, admin api is disabled when secret is empty.
+func (s *Server) SetAdminSecret(secret string) {
+	s.adminSecret = secret
+}
+
+// SetUpgradeKey set the hex ed25519 public key which sign the upgrade binary, upgrade is disabled when key is empty.
+func (s *Server) SetUpgradeKey(key string) error {
+	if key == "" {
+		s.upgradeKey = nil
+		return nil
+	}
+	raw, err := hex.DecodeString(key)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid upgrade key: %v", key)
+	}
+	s.upgradeKey = raw
+	return nil
+}
+
+// Exit return the channel which receive a value when admin api ask server to exit, true means restart.
+func (s *Server) Exit() <-chan bool {
+	return s.exit
+}
+
+func (s *Server) notifyExit(restart bool) {
+	select {
+	case s.exit <- restart:
+	default:
+	}
+}
+
+// admin check the request carry the admin secret with header "Authorization: Bearer <secret>"
+func (s *Server) admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.adminSecret == "" {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+		secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(s.adminSecret)) != 1 {
+			log.Errorln("admin [%v] %v unauthorized", r.RemoteAddr, r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+// Upgrade download the binary from header "url", check header "signature" which is the hex ed25519
+// signature of the binary sha256 by the upgrade key, then replace the running executable and restart.
+func (s *Server) Upgrade(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	if s.upgradeKey == nil {
+		http.Error(w, "upgrade key is not configured", http.StatusForbidden)
+		return
+	}
+
+	download := strings.TrimSpace(r.Header.Get("url"))
+	if !strings.HasPrefix(download, "http://") && !strings.HasPrefix(download, "https://") {
+		http.Error(w, "invalid download url", http.StatusBadRequest)
+		return
+	}
+	signature, err := hex.DecodeString(strings.TrimSpace(r.Header.Get("signature")))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		http.Error(w, "invalid signature", http.StatusBadRequest)
+		return
+	}
+
+	if !s.upgradeMux.TryLock() {
+		http.Error(w, "upgrade is running", http.StatusConflict)
+		return
+	}
+	defer s.upgradeMux.Unlock()
+
+	reader, err := util.File(download, "GET", util.WithRetry(2))
+	if err != nil {
+		http.Error(w, "download failure "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pwd, err := os.Executable()
+	if err != nil {
+		http.Error(w, "executable failure "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tempPath := filepath.Join(filepath.Dir(pwd), "tcpover.upgrade")
+	fd, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		http.Error(w, "create temp file failure "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tempPath)
+
+	hash := sha256.New()
+	_, err = io.Copy(fd, io.TeeReader(reader, hash))
+	_ = fd.Close()
+	if err != nil {
+		http.Error(w, "download copy failure "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := hash.Sum(nil)
+	if !ed25519.Verify(s.upgradeKey, sum, signature) {
+		http.Error(w, fmt.Sprintf("signature mismatch of sha256: %x", sum), http.StatusBadRequest)
+		return
+	}
+
+	err = replaceExecutable(tempPath, pwd)
+	if err != nil {
+		http.Error(w, "rename failure "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Infoln("upgrade from [%v] sha256 %x success, restarting...", download, sum)
+	raw, _ := json.Marshal(map[string]interface{}{
+		"sha256":  hex.EncodeToString(sum),
+		"restart": true,
+	})
+	_, _ = w.Write(raw)
+	s.notifyExit(true)
+}
+
+// Shutdown gracefully shutdown server, restart when query "restart" is true.
+func (s *Server) Shutdown(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	restart := r.URL.Query().Get("restart") == "true"
+	log.Infoln("admin [%v] close server, restart: %v", r.RemoteAddr, restart)
+	s.Version(w, r)
+	s.notifyExit(restart)
+}
+
+// Connections GET return the relayed connections, filter by query "user", "host" and "chain".
+// DELETE close the connection of query "id".
+func (s *Server) Connections(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodDelete) {
+		return
+	}
+
+	query := r.URL.Query()
+	if r.Method == http.MethodDelete {
+		tracker, ok := statistic.DefaultManager.Get(query.Get("id"))
+		if !ok {
+			http.Error(w, "connection not found", http.StatusNotFound)
+			return
+		}
+		_ = tracker.Close()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	user, host, chain := query.Get("user"), query.Get("host"), query.Get("chain")
+	snapshot := statistic.DefaultManager.Snapshot()
+	connections := make([]*statistic.TrackerInfo, 0, len(snapshot.Connections))
+	for _, info := range snapshot.Connections {
+		if user != "" && info.Metadata.User != user {
+			continue
+		}
+		if host != "" && info.Metadata.Host != host && info.Metadata.DstIP.String() != host {
+			continue
+		}
+		if chain != "" && !contains(info.Chain, chain) {
+			continue
+		}
+		connections = append(connections, info)
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Start.Before(connections[j].Start)
+	})
+
+	raw, _ := json.Marshal(map[string]interface{}{
+		"active":        atomic.LoadInt32(&s.conn),
+		"uploadTotal":   snapshot.UploadTotal,
+		"downloadTotal": snapshot.DownloadTotal,
+		"connections":   connections,
+	})
+	_, _ = w.Write(raw)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// AgentsHandler GET return the registered agents, PUT push the config of body to agents of query "name".
+// DELETE kick the agents of query "name", only the one connected from query "addr" when it is set,
+// they are drained when query "drain" is true.
+func (s *Server) AgentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "name is empty", http.StatusBadRequest)
+			return
+		}
+		var config control.Config
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, "invalid config "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := rules.NewACL(config.Allow, config.Deny); err != nil {
+			http.Error(w, "invalid acl "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infoln("admin [%v] push config to agent [%v]: %+v", r.RemoteAddr, name, config)
+		s.SetAgentConfig(name, config)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		query := r.URL.Query()
+		name, addr, drain := query.Get("name"), query.Get("addr"), query.Get("drain") == "true"
+		var kicked int
+		for _, a := range s.agents(name) {
+			if name == "" || (addr != "" && a.addr != addr) {
+				continue
+			}
+			if drain {
+				log.Infoln("admin [%v] drain agent [%v] %v", r.RemoteAddr, name, a.addr)
+				if err := a.drain(); err != nil {
+					log.Errorln("drain agent [%v] %v: %v", name, a.addr, err)
+				}
+			} else {
+				log.Infoln("admin [%v] kick agent [%v] %v", r.RemoteAddr, name, a.addr)
+				a.kick()
+			}
+			kicked++
+		}
+		if kicked == 0 {
+			http.Error(w, "agent not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	agents := s.Agents()
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	raw, _ := json.Marshal(map[string]interface{}{
+		"agents": agents,
+	})
+	_, _ = w.Write(raw)
+}
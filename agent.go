@@ -0,0 +1,400 @@
+package tcpover
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tiechui1994/tcpover/transport/control"
+	"github.com/tiechui1994/tool/log"
+)
+
+const (
+	agentPingInterval = 10 * time.Second
+	// agentTimeout is the max silence of agent, it is unregistered when no message or pong is received
+	agentTimeout      = 3 * agentPingInterval
+	agentWriteTimeout = 10 * time.Second
+)
+
+// agent is the manager connection of passive side registered with name
+type agent struct {
+	conn      *websocket.Conn
+	writeMux  sync.Mutex
+	name      string
+	user      string
+	addr      string
+	version   string
+	connected time.Time
+	active    int64 // number of active forward connections
+
+	stateMux sync.RWMutex
+	hello    *control.Hello // nil is protocol version 1
+	draining bool
+	lastPing time.Time
+	pingRTT  time.Duration
+	pingErr  error
+
+	listeners []net.Listener // reverse forward listeners on server
+	closed    bool
+}
+
+type AgentInfo struct {
+	Name       string    `json:"name"`
+	User       string    `json:"user"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Version    string    `json:"version"`
+	Protocol   int       `json:"protocol"`
+	Protos     []string  `json:"protos"`
+	Mux        bool      `json:"mux"`
+	Services   []string  `json:"services"`
+	Listeners  []string  `json:"listeners"`
+	Draining   bool      `json:"draining"`
+	Connected  time.Time `json:"connected"`
+	LastPing   time.Time `json:"lastPing"`
+	PingRTT    int64     `json:"pingRTT"` // milliseconds
+	PingError  string    `json:"pingError,omitempty"`
+	Active     int64     `json:"active"`
+}
+
+func newAgent(name, user string, r *http.Request, conn *websocket.Conn) *agent {
+	a := &agent{
+		conn:      conn,
+		name:      name,
+		user:      user,
+		addr:      r.RemoteAddr,
+		version:   r.Header.Get("X-Version"),
+		connected: time.Now(),
+	}
+	conn.SetPongHandler(func(data string) error {
+		if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+			a.pong(sent)
+		}
+		return a.refreshDeadline()
+	})
+	return a
+}
+
+// send is safe to call concurrently
+func (a *agent) send(command uint32, data interface{}) error {
+	msg, err := control.NewMessage(command, data)
+	if err != nil {
+		return err
+	}
+	a.writeMux.Lock()
+	defer a.writeMux.Unlock()
+	_ = a.conn.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	return a.conn.WriteJSON(msg)
+}
+
+// refreshDeadline extend the read deadline when agent is alive
+func (a *agent) refreshDeadline() error {
+	return a.conn.SetReadDeadline(time.Now().Add(agentTimeout))
+}
+
+func (a *agent) protocol() int {
+	a.stateMux.RLock()
+	defer a.stateMux.RUnlock()
+	if a.hello == nil {
+		return 1
+	}
+	return a.hello.Version
+}
+
+func (a *agent) setHello(hello *control.Hello) {
+	a.stateMux.Lock()
+	a.hello = hello
+	a.stateMux.Unlock()
+}
+
+func (a *agent) setDraining() {
+	a.stateMux.Lock()
+	a.draining = true
+	a.stateMux.Unlock()
+}
+
+// available check the agent can accept the proto, mux and service of link
+func (a *agent) available(link *control.Link) bool {
+	a.stateMux.RLock()
+	defer a.stateMux.RUnlock()
+	if a.draining {
+		return false
+	}
+	if a.hello == nil {
+		return link.Service == ""
+	}
+	if link.Mux && !a.hello.Mux {
+		return false
+	}
+	if link.Service != "" {
+		return contains(a.hello.Services, link.Service)
+	}
+	return contains(a.hello.Protos, link.Proto)
+}
+
+// acceptListen check the agent is connector of reverse forward
+func (a *agent) acceptListen() bool {
+	a.stateMux.RLock()
+	defer a.stateMux.RUnlock()
+	return !a.draining && a.hello != nil && a.hello.Listen
+}
+
+func (a *agent) hasService(service string) bool {
+	a.stateMux.RLock()
+	defer a.stateMux.RUnlock()
+	return a.hello != nil && contains(a.hello.Services, service)
+}
+
+// addListener keep the reverse forward listener, false when agent is closed
+func (a *agent) addListener(l net.Listener) bool {
+	a.stateMux.Lock()
+	defer a.stateMux.Unlock()
+	if a.closed {
+		return false
+	}
+	a.listeners = append(a.listeners, l)
+	return true
+}
+
+// closeListeners close the reverse forward listeners when agent is unregistered
+func (a *agent) closeListeners() {
+	a.stateMux.Lock()
+	defer a.stateMux.Unlock()
+	a.closed = true
+	for _, l := range a.listeners {
+		_ = l.Close()
+	}
+	a.listeners = nil
+}
+
+// ping send ping with the send time, the result is updated when pong is received.
+// The agent of protocol version 1 never answer Ping, websocket ping is used.
+func (a *agent) ping() error {
+	now := time.Now()
+	var err error
+	if a.protocol() >= 2 {
+		err = a.send(control.CommandPing, control.Ping{Time: now.UnixNano()})
+	} else {
+		data := []byte(strconv.FormatInt(now.UnixNano(), 10))
+		err = a.conn.WriteControl(websocket.PingMessage, data, now.Add(agentWriteTimeout))
+	}
+	if err != nil {
+		a.stateMux.Lock()
+		a.pingErr = err
+		a.stateMux.Unlock()
+	}
+	return err
+}
+
+func (a *agent) pong(sent int64) {
+	a.stateMux.Lock()
+	a.lastPing = time.Now()
+	a.pingRTT = a.lastPing.Sub(time.Unix(0, sent))
+	a.pingErr = nil
+	a.stateMux.Unlock()
+}
+
+func (a *agent) info() AgentInfo {
+	a.stateMux.RLock()
+	defer a.stateMux.RUnlock()
+	info := AgentInfo{
+		Name:       a.name,
+		User:       a.user,
+		RemoteAddr: a.addr,
+		Version:    a.version,
+		Protocol:   1,
+		Draining:   a.draining,
+		Connected:  a.connected,
+		LastPing:   a.lastPing,
+		PingRTT:    a.pingRTT.Milliseconds(),
+		Active:     atomic.LoadInt64(&a.active),
+	}
+	if a.hello != nil {
+		info.Protocol = a.hello.Version
+		info.Protos = a.hello.Protos
+		info.Mux = a.hello.Mux
+		info.Services = a.hello.Services
+	}
+	for _, l := range a.listeners {
+		info.Listeners = append(info.Listeners, l.Addr().String())
+	}
+	if a.pingErr != nil {
+		info.PingError = a.pingErr.Error()
+	}
+	return info
+}
+
+// drain ask agent to stop new links and close when active links are done, version 1 agent is kicked.
+func (a *agent) drain() error {
+	a.setDraining()
+	if a.protocol() < 2 {
+		a.kick()
+		return nil
+	}
+	return a.send(control.CommandDrain, control.Drain{Reason: "drained by server"})
+}
+
+// kick close the agent connection, the agent will not reconnect.
+func (a *agent) kick() {
+	closeWithReason(a.conn, websocket.ClosePolicyViolation, "kicked")
+	_ = a.conn.Close()
+}
+
+// Policy of agents registered with the same name
+const (
+	AgentPolicyReject     = "reject"      // reject the later agent
+	AgentPolicyRoundRobin = "round-robin" // link the agents in turn
+	AgentPolicyLeastConn  = "least-conn"  // link the agent with least active connections
+)
+
+var (
+	ErrDuplicateAgent   = errors.New("duplicate agent name")
+	ErrAgentUser        = errors.New("agent name is used by other user")
+	ErrAgentNotRunning  = errors.New("agent not running")
+	ErrAgentUnavailable = errors.New("agent unavailable")
+)
+
+type agentGroup struct {
+	agents []*agent
+	next   uint32
+}
+
+// SetAgentPolicy set the policy of agents with the same name, default is reject.
+func (s *Server) SetAgentPolicy(policy string) error {
+	switch policy {
+	case "":
+		policy = AgentPolicyReject
+	case AgentPolicyReject, AgentPolicyRoundRobin, AgentPolicyLeastConn:
+	default:
+		return fmt.Errorf("unsupported agent policy: %v", policy)
+	}
+	s.agentPolicy = policy
+	return nil
+}
+
+func (s *Server) registerAgent(a *agent) error {
+	s.manageMux.Lock()
+	defer s.manageMux.Unlock()
+	group, ok := s.manageConn[a.name]
+	if !ok {
+		group = &agentGroup{}
+		s.manageConn[a.name] = group
+	}
+	if len(group.agents) > 0 && s.agentPolicy == AgentPolicyReject {
+		return ErrDuplicateAgent
+	}
+	// the agents of group must belong to the same user, the links of user can not be taken by others
+	if len(group.agents) > 0 && group.agents[0].user != a.user {
+		return ErrAgentUser
+	}
+	group.agents = append(group.agents, a)
+	return nil
+}
+
+func (s *Server) unregisterAgent(a *agent) {
+	s.manageMux.Lock()
+	defer s.manageMux.Unlock()
+	group, ok := s.manageConn[a.name]
+	if !ok {
+		return
+	}
+	for i, v := range group.agents {
+		if v == a {
+			group.agents = append(group.agents[:i], group.agents[i+1:]...)
+			break
+		}
+	}
+	if len(group.agents) == 0 {
+		delete(s.manageConn, a.name)
+		s.removeConnectorListen(a.name)
+	}
+}
+
+// pickAgent return the agent of name which can accept link with policy
+func (s *Server) pickAgent(name string, link *control.Link) (*agent, error) {
+	s.manageMux.Lock()
+	defer s.manageMux.Unlock()
+	group, ok := s.manageConn[name]
+	if !ok || len(group.agents) == 0 {
+		return nil, ErrAgentNotRunning
+	}
+
+	size := uint32(len(group.agents))
+	start := group.next % size
+	group.next++
+	var selected *agent
+	for i := uint32(0); i < size; i++ {
+		a := group.agents[(start+i)%size]
+		if !a.available(link) {
+			continue
+		}
+		if selected == nil {
+			selected = a
+			if s.agentPolicy == AgentPolicyRoundRobin {
+				break
+			}
+		} else if atomic.LoadInt64(&a.active) < atomic.LoadInt64(&selected.active) {
+			selected = a
+		}
+	}
+	if selected == nil {
+		return nil, ErrAgentUnavailable
+	}
+	return selected, nil
+}
+
+// SetAgentConfig push config to the agents of name, it is also pushed to the agent registered later.
+func (s *Server) SetAgentConfig(name string, config control.Config) {
+	s.manageMux.Lock()
+	s.agentConfig[name] = config
+	s.manageMux.Unlock()
+
+	for _, a := range s.agents(name) {
+		if a.protocol() < 2 {
+			continue
+		}
+		if err := a.send(control.CommandConfig, config); err != nil {
+			log.Errorln("agent [%v] %v push config: %v", name, a.addr, err)
+		}
+	}
+}
+
+func (s *Server) agentHello(a *agent, hello *control.Hello) {
+	a.setHello(hello)
+	s.manageMux.RLock()
+	config, ok := s.agentConfig[a.name]
+	s.manageMux.RUnlock()
+	if ok && hello.Version >= 2 {
+		if err := a.send(control.CommandConfig, config); err != nil {
+			log.Errorln("agent [%v] %v push config: %v", a.name, a.addr, err)
+		}
+	}
+	s.replayListen(a)
+}
+
+// agents return the agents of name, all agents when name is empty
+func (s *Server) agents(name string) []*agent {
+	s.manageMux.RLock()
+	defer s.manageMux.RUnlock()
+	var agents []*agent
+	for key, group := range s.manageConn {
+		if name == "" || key == name {
+			agents = append(agents, group.agents...)
+		}
+	}
+	return agents
+}
+
+// Agents return the registered agents
+func (s *Server) Agents() []AgentInfo {
+	agents := make([]AgentInfo, 0)
+	for _, a := range s.agents("") {
+		agents = append(agents, a.info())
+	}
+	return agents
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/tiechui1994/tcpover/transport"
+)
+
+func listenPort(addr string) int {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.Atoi(port)
+	return v
+}
+
+func (c *controller) configs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listeners := transport.Listeners()
+		render(w, http.StatusOK, map[string]interface{}{
+			"port":       listenPort(listeners["http"]),
+			"socks-port": listenPort(listeners["socks"]),
+			"mixed-port": listenPort(listeners["mixed"]),
+			"allow-lan":  false,
+			"mode":       "rule",
+			"log-level":  transport.LevelInfo,
+		})
+	case http.MethodPut:
+		// the path of body is ignored, the config file of client is reloaded
+		if c.reload == nil {
+			render(w, http.StatusBadRequest, newError("reload is not supported"))
+			return
+		}
+		if err := c.reload(); err != nil {
+			render(w, http.StatusBadRequest, newError(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		render(w, http.StatusMethodNotAllowed, newError("Method Not Allowed"))
+	}
+}
+
+func getRules(w http.ResponseWriter, r *http.Request) {
+	type rule struct {
+		Type    string `json:"type"`
+		Payload string `json:"payload"`
+		Proxy   string `json:"proxy"`
+	}
+
+	list := transport.Rules()
+	rules := make([]rule, 0, len(list))
+	for _, v := range list {
+		rules = append(rules, rule{Type: v.Name(), Payload: v.Payload(), Proxy: v.Adapter()})
+	}
+	render(w, http.StatusOK, map[string]interface{}{"rules": rules})
+}
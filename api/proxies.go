@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport"
+	"github.com/tiechui1994/tcpover/transport/outboundgroup"
+)
+
+type delayHistory struct {
+	Time  time.Time `json:"time"`
+	Delay uint16    `json:"delay"`
+}
+
+// delays keep the last delay test of proxy, name <=> delayHistory
+var delays sync.Map
+
+func proxyInfo(proxy ctx.Proxy) map[string]interface{} {
+	history := []delayHistory{}
+	if v, ok := delays.Load(proxy.Name()); ok {
+		history = append(history, v.(delayHistory))
+	}
+
+	info := map[string]interface{}{
+		"name":    proxy.Name(),
+		"type":    proxy.Type(),
+		"udp":     proxy.SupportUDP(),
+		"history": history,
+	}
+	if group, ok := proxy.(outboundgroup.Group); ok {
+		all := make([]string, 0, len(group.Proxies()))
+		for _, p := range group.Proxies() {
+			all = append(all, p.Name())
+		}
+		info["all"] = all
+		info["now"] = group.Now()
+	}
+	return info
+}
+
+func (c *controller) proxies(w http.ResponseWriter, r *http.Request, path []string) {
+	all := transport.Proxies()
+	if len(path) == 0 {
+		if r.Method != http.MethodGet {
+			render(w, http.StatusMethodNotAllowed, newError("Method Not Allowed"))
+			return
+		}
+		infos := make(map[string]interface{}, len(all))
+		for name, proxy := range all {
+			infos[name] = proxyInfo(proxy)
+		}
+		render(w, http.StatusOK, map[string]interface{}{"proxies": infos})
+		return
+	}
+
+	proxy, ok := all[path[0]]
+	if !ok {
+		render(w, http.StatusNotFound, newError("Resource not found"))
+		return
+	}
+
+	switch {
+	case len(path) == 1 && r.Method == http.MethodGet:
+		render(w, http.StatusOK, proxyInfo(proxy))
+	case len(path) == 1 && r.Method == http.MethodPut:
+		updateProxy(w, r, proxy)
+	case len(path) == 2 && path[1] == "delay" && r.Method == http.MethodGet:
+		getProxyDelay(w, r, proxy)
+	default:
+		render(w, http.StatusMethodNotAllowed, newError("Method Not Allowed"))
+	}
+}
+
+func updateProxy(w http.ResponseWriter, r *http.Request, proxy ctx.Proxy) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		render(w, http.StatusBadRequest, newError("Body invalid"))
+		return
+	}
+
+	selector, ok := proxy.(*outboundgroup.Selector)
+	if !ok {
+		render(w, http.StatusBadRequest, newError("Must be a Selector"))
+		return
+	}
+	if err := selector.Set(req.Name); err != nil {
+		render(w, http.StatusBadRequest, newError(err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getProxyDelay(w http.ResponseWriter, r *http.Request, proxy ctx.Proxy) {
+	query := r.URL.Query()
+	target := query.Get("url")
+	timeout, err := strconv.Atoi(query.Get("timeout"))
+	if target == "" || err != nil || timeout <= 0 {
+		render(w, http.StatusBadRequest, newError("Body invalid"))
+		return
+	}
+
+	ct, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Millisecond)
+	defer cancel()
+
+	delay, err := outboundgroup.URLDelay(ct, proxy, target)
+	if ct.Err() != nil {
+		render(w, http.StatusGatewayTimeout, newError("Timeout"))
+		return
+	}
+	if err != nil {
+		render(w, http.StatusServiceUnavailable, newError("An error occurred in the delay test"))
+		return
+	}
+
+	delays.Store(proxy.Name(), delayHistory{Time: time.Now(), Delay: delay})
+	render(w, http.StatusOK, map[string]uint16{"delay": delay})
+}
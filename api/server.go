@@ -0,0 +1,189 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/tiechui1994/tool/log"
+)
+
+// Version is reported by GET /version
+var Version = "tcpover"
+
+type controller struct {
+	secret   string
+	reload   func() error
+	upgrader websocket.Upgrader
+}
+
+// Start run the Clash compatible RESTful API at addr, reload is called by PUT /configs.
+func Start(addr, secret string, reload func() error) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := http.Serve(listener, New(secret, reload)); err != nil {
+			log.Errorln("RESTful API serve: %v", err)
+		}
+	}()
+	return nil
+}
+
+// New return the handler of RESTful API, the request must carry "Authorization: Bearer <secret>"
+// or query "token" when secret is not empty. Cross origin request is only allowed with secret,
+// otherwise any web page could drive the API of local client.
+func New(secret string, reload func() error) http.Handler {
+	c := &controller{
+		secret: secret,
+		reload: reload,
+	}
+	if secret != "" {
+		c.upgrader.CheckOrigin = func(r *http.Request) bool {
+			return true
+		}
+	}
+	return c
+}
+
+func (c *controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.secret != "" {
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", "*")
+		header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+		header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !c.authenticate(r) {
+		render(w, http.StatusUnauthorized, newError("Unauthorized"))
+		return
+	}
+
+	path := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i := range path {
+		path[i], _ = url.PathUnescape(path[i])
+	}
+
+	switch path[0] {
+	case "":
+		render(w, http.StatusOK, map[string]string{"hello": "tcpover"})
+	case "version":
+		render(w, http.StatusOK, map[string]interface{}{"version": Version, "meta": false})
+	case "logs":
+		c.getLogs(w, r)
+	case "traffic":
+		c.traffic(w, r)
+	case "connections":
+		c.connections(w, r, path[1:])
+	case "proxies":
+		c.proxies(w, r, path[1:])
+	case "rules":
+		getRules(w, r)
+	case "configs":
+		c.configs(w, r)
+	default:
+		render(w, http.StatusNotFound, newError("Not Found"))
+	}
+}
+
+func (c *controller) authenticate(r *http.Request) bool {
+	if c.secret == "" {
+		return true
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if websocket.IsWebSocketUpgrade(r) && r.URL.Query().Get("token") != "" {
+		token = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.secret)) == 1
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+func newError(msg string) *apiError {
+	return &apiError{Message: msg}
+}
+
+func render(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// stream send the value of next to websocket or chunked http response at every interval,
+// it stops when next return false or the client is gone. done is closed when the client is gone,
+// the blocking next should wait on it.
+func (c *controller) stream(w http.ResponseWriter, r *http.Request, interval time.Duration, next func(done <-chan struct{}) (interface{}, bool)) {
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := c.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// the context of request is not cancelled after hijack, so the reader report the close
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			// read until closed, the control messages are handled by gorilla
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}()
+
+		for {
+			v, ok := next(done)
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(v); err != nil {
+				return
+			}
+			if interval > 0 {
+				time.Sleep(interval)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		default:
+		}
+
+		v, ok := next(r.Context().Done())
+		if !ok {
+			return
+		}
+		if err := encoder.Encode(v); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if interval > 0 {
+			time.Sleep(interval)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tiechui1994/tcpover/transport"
+	"github.com/tiechui1994/tcpover/transport/statistic"
+)
+
+type Traffic struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+func (c *controller) traffic(w http.ResponseWriter, r *http.Request) {
+	c.stream(w, r, time.Second, func(<-chan struct{}) (interface{}, bool) {
+		up, down := statistic.DefaultManager.Now()
+		return &Traffic{Up: up, Down: down}, true
+	})
+}
+
+var logLevels = map[string]int{
+	transport.LevelDebug: 0,
+	transport.LevelInfo:  1,
+	transport.LevelWarn:  2,
+	transport.LevelError: 3,
+}
+
+func (c *controller) getLogs(w http.ResponseWriter, r *http.Request) {
+	level, ok := logLevels[r.URL.Query().Get("level")]
+	if !ok {
+		level = logLevels[transport.LevelInfo]
+	}
+
+	events, cancel := transport.SubscribeLogs()
+	defer cancel()
+
+	c.stream(w, r, 0, func(done <-chan struct{}) (interface{}, bool) {
+		for {
+			select {
+			case <-done:
+				return nil, false
+			case event, ok := <-events:
+				if !ok {
+					return nil, false
+				}
+				if logLevels[event.Type] >= level {
+					return event, true
+				}
+			}
+		}
+	})
+}
+
+func (c *controller) connections(w http.ResponseWriter, r *http.Request, path []string) {
+	switch {
+	case r.Method == http.MethodGet && len(path) == 0:
+		if !isStream(r) {
+			render(w, http.StatusOK, statistic.DefaultManager.Snapshot())
+			return
+		}
+
+		interval := time.Second
+		if v, err := strconv.Atoi(r.URL.Query().Get("interval")); err == nil && v > 0 {
+			interval = time.Duration(v) * time.Millisecond
+		}
+		c.stream(w, r, interval, func(<-chan struct{}) (interface{}, bool) {
+			return statistic.DefaultManager.Snapshot(), true
+		})
+	case r.Method == http.MethodDelete && len(path) == 0:
+		statistic.DefaultManager.CloseAll()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete && len(path) == 1:
+		if tracker, ok := statistic.DefaultManager.Get(path[0]); ok {
+			_ = tracker.Close()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		render(w, http.StatusMethodNotAllowed, newError("Method Not Allowed"))
+	}
+}
+
+func isStream(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != ""
+}
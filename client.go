@@ -9,9 +9,12 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/tiechui1994/tcpover/config"
+	"github.com/tiechui1994/tcpover/api"
+	cfg "github.com/tiechui1994/tcpover/config"
 	"github.com/tiechui1994/tcpover/ctx"
 	"github.com/tiechui1994/tcpover/transport"
+	"github.com/tiechui1994/tcpover/transport/common/bufio"
+	"github.com/tiechui1994/tcpover/transport/mux"
 	"github.com/tiechui1994/tcpover/transport/vless"
 	"github.com/tiechui1994/tcpover/transport/wless"
 	"github.com/tiechui1994/tcpover/transport/wss"
@@ -24,6 +27,8 @@ var (
 
 type Client struct {
 	server string
+	auth   *wss.Auth
+	uuid   string
 }
 
 func NewClient(server string, proxy map[string][]string) *Client {
@@ -34,11 +39,22 @@ func NewClient(server string, proxy map[string][]string) *Client {
 		proxy = map[string][]string{}
 	}
 
+	wss.Version = Version
 	return &Client{
 		server: server,
 	}
 }
 
+// SetAuth set the credential of websocket connection
+func (c *Client) SetAuth(auth *wss.Auth) {
+	c.auth = auth
+}
+
+// SetUUID set the uuid of vless protocol
+func (c *Client) SetUUID(uuid string) {
+	c.uuid = uuid
+}
+
 func (c *Client) Std(remoteName, remoteAddr string, _type ctx.ProxyType, header map[string]string) error {
 	var std io.ReadWriteCloser = NewStdReadWriteCloser()
 	if Debug {
@@ -53,21 +69,45 @@ func (c *Client) Std(remoteName, remoteAddr string, _type ctx.ProxyType, header
 	return nil
 }
 
-func (c *Client) Serve(config config.RawConfig) error {
-	for _, v := range config.Proxies {
-		proxy, err := transport.ParseProxy(v)
+func (c *Client) Serve(config cfg.RawConfig) error {
+	err := transport.ApplyConfig(config.Proxies, config.Groups, config.Rules)
+	if err != nil {
+		return err
+	}
+
+	listeners := config.Listeners
+	if config.Listen != "" {
+		listeners = append(listeners, cfg.Listener{Type: "mixed", Listen: config.Listen})
+	}
+	if len(listeners) == 0 && len(config.Services) == 0 {
+		return fmt.Errorf("no listener configured")
+	}
+	for _, v := range listeners {
+		log.Infoln("listen %v [%v] ...", v.Type, v.Listen)
+		err := transport.RegisterListener(v.Type, v.Listen)
 		if err != nil {
 			return err
 		}
+	}
 
-		transport.RegisterProxy(proxy)
+	for _, v := range config.Services {
+		log.Infoln("listen service [%v] of agent [%v] on [%v] ...", v.Name, v.Agent, v.Listen)
+		err := c.ServeService(v.Listen, v.Agent, v.Name)
+		if err != nil {
+			return err
+		}
 	}
 
-	listenAddr := fmt.Sprintf("%v", config.Listen)
-	log.Infoln("listen [%v] ...", config.Listen)
-	err := transport.RegisterListener("mixed", listenAddr)
-	if err != nil {
-		return err
+	if config.ExternalController != "" {
+		log.Infoln("RESTful API listening at: %v", config.ExternalController)
+		// the path of request is ignored, only the loaded config file can be reloaded
+		reload := func() error {
+			return c.reload(config.Path)
+		}
+		api.Version = Version
+		if err := api.Start(config.ExternalController, config.Secret, reload); err != nil {
+			return err
+		}
 	}
 
 	done := make(chan struct{})
@@ -75,28 +115,203 @@ func (c *Client) Serve(config config.RawConfig) error {
 	return nil
 }
 
+// ServeService listen on addr, the accepted connection is relayed to the service published by agent.
+func (c *Client) ServeService(addr, agent, service string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go acceptLoop(listener, "service "+service, func(conn net.Conn) {
+		defer conn.Close()
+		remote, err := wss.WebSocketConnect(context.Background(), c.server, &wss.ConnectParam{
+			Name:    agent,
+			Mode:    wss.ModeForward,
+			Service: service,
+			Auth:    c.auth,
+		})
+		if err != nil {
+			log.Errorln("service [%v] of agent [%v] connect: %v", service, agent, err)
+			return
+		}
+		defer remote.Close()
+		bufio.Relay(conn, remote, nil)
+	})
+	return nil
+}
+
+// reload apply proxies, proxy groups and rules of config file, listeners are not changed
+func (c *Client) reload(path string) error {
+	if path == "" {
+		return fmt.Errorf("config path is empty")
+	}
+	config, err := cfg.Parse(path)
+	if err != nil {
+		return err
+	}
+	err = transport.ApplyConfig(config.Proxies, config.Groups, config.Rules)
+	if err != nil {
+		return err
+	}
+	log.Infoln("reload config [%v] success", path)
+	return nil
+}
+
+// LocalForward is the mapping of -L, connection accepted on Listen is relayed to RemoteAddr,
+// directly by server when RemoteName is empty, otherwise by the agent of RemoteName.
+type LocalForward struct {
+	Listen     string
+	RemoteName string
+	RemoteAddr string
+}
+
+// ParseLocalForward parse mapping of format: local:port=[remoteName/]target:port
+func ParseLocalForward(s string) (LocalForward, error) {
+	kv := strings.SplitN(strings.TrimSpace(s), "=", 2)
+	if len(kv) != 2 {
+		return LocalForward{}, fmt.Errorf("invalid forward %q, format: local:port=[remoteName/]target:port", s)
+	}
+
+	forward := LocalForward{Listen: kv[0], RemoteAddr: kv[1]}
+	if i := strings.Index(kv[1], "/"); i >= 0 {
+		forward.RemoteName, forward.RemoteAddr = kv[1][:i], kv[1][i+1:]
+	}
+	if _, _, err := net.SplitHostPort(forward.Listen); err != nil {
+		return LocalForward{}, fmt.Errorf("invalid forward %q: %w", s, err)
+	}
+	if _, _, err := net.SplitHostPort(forward.RemoteAddr); err != nil {
+		return LocalForward{}, fmt.Errorf("invalid forward %q: %w", s, err)
+	}
+	return forward, nil
+}
+
+func (f LocalForward) String() string {
+	if f.RemoteName == "" {
+		return fmt.Sprintf("%v=%v", f.Listen, f.RemoteAddr)
+	}
+	return fmt.Sprintf("%v=%v/%v", f.Listen, f.RemoteName, f.RemoteAddr)
+}
+
+// Forward listen on the local address of forwards, each accepted connection open a stream of proto
+// to the remote address, the streams of the same mapping share websocket connections when mux is set.
+func (c *Client) Forward(forwards []LocalForward, proto ctx.ProxyType, header map[string]string, useMux bool) error {
+	if len(forwards) == 0 {
+		return fmt.Errorf("no forward configured")
+	}
+
+	listeners := make([]net.Listener, 0, len(forwards))
+	for _, v := range forwards {
+		listener, err := net.Listen("tcp", v.Listen)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+		log.Infoln("forward [%v] => [%v] %v ...", v.Listen, v.RemoteName, v.RemoteAddr)
+		listeners = append(listeners, listener)
+	}
+
+	errCh := make(chan error, len(forwards))
+	for i, v := range forwards {
+		go func(listener net.Listener, forward LocalForward) {
+			errCh <- c.serveForward(listener, forward, proto, header, useMux)
+		}(listeners[i], v)
+	}
+	return <-errCh
+}
+
+func (c *Client) serveForward(listener net.Listener, forward LocalForward, proto ctx.ProxyType, header map[string]string, useMux bool) error {
+	defer listener.Close()
+
+	var muxClient *mux.Client
+	if useMux {
+		muxClient = mux.NewClient(mux.Option{}, func() (net.Conn, error) {
+			return c.connectServer(forward.RemoteName, "sp.mux.sing-box.arpa:444", proto, header, true)
+		})
+	}
+	metadata, err := targetMetadata(forward.RemoteAddr)
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("forward [%v] accept: %w", forward.Listen, err)
+		}
+
+		go func() {
+			defer conn.Close()
+			var (
+				remote net.Conn
+				err    error
+			)
+			if muxClient != nil {
+				remote, err = muxClient.DialContext(context.Background(), metadata)
+			} else {
+				remote, err = c.connectServer(forward.RemoteName, forward.RemoteAddr, proto, header, false)
+			}
+			if err != nil {
+				log.Errorln("forward [%v] connect: %v", forward, err)
+				return
+			}
+			defer remote.Close()
+			bufio.Relay(conn, remote, nil)
+		}()
+	}
+}
+
+func targetMetadata(addr string) (*ctx.Metadata, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	portVal, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port of %v", addr)
+	}
+	return &ctx.Metadata{NetWork: "tcp", Host: host, DstPort: uint16(portVal)}, nil
+}
+
 func (c *Client) stdConnectServer(local io.ReadWriteCloser, remoteName, remoteAddr string, proto ctx.ProxyType, header map[string]string) error {
+	remote, err := c.connectServer(remoteName, remoteAddr, proto, header, false)
+	if err != nil {
+		return err
+	}
+
+	relayStd(local, remote)
+	return nil
+}
+
+// connectServer open websocket connection to server and handshake the stream of remoteAddr with proto
+func (c *Client) connectServer(remoteName, remoteAddr string, proto ctx.ProxyType, header map[string]string, useMux bool) (net.Conn, error) {
 	var mode = wss.ModeForward
 	if remoteName == "" || remoteName == remoteAddr {
 		mode = wss.ModeDirect
 	}
+	if useMux {
+		mode = mode.Mux()
+	}
 
 	conn, err := wss.WebSocketConnect(context.Background(), c.server, &wss.ConnectParam{
 		Name:   remoteName,
 		Mode:   mode,
 		Header: wss.Header(proto, header),
+		Auth:   c.auth,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	switch proto {
 	case ctx.Vless:
-		client, _ := vless.NewClient("")
+		client, _ := vless.NewClient(c.uuid)
 		var host, port string
 		host, port, err = net.SplitHostPort(remoteAddr)
 		if err != nil {
-			return err
+			_ = conn.Close()
+			return nil, err
 		}
 		portVal, _ := strconv.Atoi(port)
 		conn, err = client.StreamConn(conn, &vless.DstAddr{
@@ -109,26 +324,27 @@ func (c *Client) stdConnectServer(local io.ReadWriteCloser, remoteName, remoteAd
 		conn, err = wless.NewClient().StreamConn(conn, remoteAddr)
 	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	remote := conn
+	return conn, nil
+}
 
+func relayStd(local io.ReadWriteCloser, remote net.Conn) {
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
 
 		defer local.Close()
-		_, err = io.CopyBuffer(remote, local, make([]byte, wss.SocketBufferLength))
+		_, _ = io.CopyBuffer(remote, local, make([]byte, wss.SocketBufferLength))
 	}()
 
 	go func() {
 		defer wg.Done()
 
 		defer remote.Close()
-		_, err = io.CopyBuffer(local, remote, make([]byte, wss.SocketBufferLength))
+		_, _ = io.CopyBuffer(local, remote, make([]byte, wss.SocketBufferLength))
 	}()
 
 	wg.Wait()
-	return nil
 }
@@ -15,7 +15,11 @@ import (
 	"github.com/tiechui1994/tcpover"
 	"github.com/tiechui1994/tcpover/config"
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
+	"github.com/tiechui1994/tcpover/transport/anytls"
+	"github.com/tiechui1994/tcpover/transport/control"
 	"github.com/tiechui1994/tcpover/transport/outbound"
+	vlessproto "github.com/tiechui1994/tcpover/transport/vless"
 	"github.com/tiechui1994/tcpover/transport/wss"
 	"github.com/tiechui1994/tool/log"
 )
@@ -43,6 +47,60 @@ func (h *header) Set(s string) error {
 
 func (h *header) Get() interface{} { return h.data }
 
+// services is the published services of agent, format: name=addr
+type services struct {
+	data map[string]string
+}
+
+func (e *services) String() string {
+	return fmt.Sprintf("%+v", e.data)
+}
+
+func (e *services) Set(s string) error {
+	kv := strings.SplitN(strings.TrimSpace(s), "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("invalid service %q, format: name=addr", s)
+	}
+	if e.data == nil {
+		e.data = make(map[string]string)
+	}
+	e.data[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	return nil
+}
+
+// forwards is the local port forwards of connector
+type forwards struct {
+	data []tcpover.LocalForward
+}
+
+func (f *forwards) String() string {
+	return fmt.Sprintf("%v", f.data)
+}
+
+func (f *forwards) Set(s string) error {
+	forward, err := tcpover.ParseLocalForward(s)
+	if err != nil {
+		return err
+	}
+	f.data = append(f.data, forward)
+	return nil
+}
+
+// reverses is the reverse forwards of agent, format: [connector/]listen=target
+type reverses []string
+
+func (r *reverses) String() string {
+	return fmt.Sprintf("%v", *r)
+}
+
+func (r *reverses) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("invalid reverse %q, format: [connector/]listen=target", s)
+	}
+	*r = append(*r, strings.TrimSpace(s))
+	return nil
+}
+
 func main() {
 	runAsConnector := flag.Bool("c", false, "as connector")
 	runAsAgent := flag.Bool("a", false, "as agent")
@@ -57,23 +115,52 @@ func main() {
 	remoteAddr := flag.String("addr", "", "want to connect remote addr. [C]")
 
 	vless := flag.Bool("vless", false, "support vless protocol. default wless protocol")
+	uuid := flag.String("uuid", "", "vless uuid, random when empty. [CA]")
 	cloudflare := flag.Bool("cf", false, "cloudflare proxy ip")
 	gcore := flag.Bool("gc", false, "gcore proxy ip")
 
 	h := new(header)
 	flag.Var(h, "H", "protocol http header. [C]")
 
+	expose := new(services)
+	flag.Var(expose, "expose", "publish service of agent, eg: ssh-office=127.0.0.1:22. [A]")
+
+	local := new(forwards)
+	flag.Var(local, "L", "local port forward, eg: 127.0.0.1:2222=agent/127.0.0.1:22, direct when agent is empty. [C]")
+
+	reverse := new(reverses)
+	flag.Var(reverse, "R", "reverse forward, eg: 0.0.0.0:8080=127.0.0.1:3000, laptop/127.0.0.1:8080=127.0.0.1:3000. [A]")
+	acceptReverse := flag.Bool("accept-reverse", false, "accept reverse forward listen of other agents. [A]")
+
+	configFile := flag.String("f", "", "config file, yaml or json. [SA]")
+
+	user := flag.String("user", "", "auth user name. [CA]")
+	token := flag.String("token", "", "auth user token. [CA]")
+	secret := flag.String("secret", "", "auth user secret, sign request with HMAC. [CA]")
+
 	flag.Parse()
 
+	var rawConfig *config.RawConfig
+	if *configFile != "" {
+		var err error
+		rawConfig, err = config.Parse(*configFile)
+		if err != nil {
+			log.Fatalln("%v", err)
+		}
+	}
+
 	if !*runAsServer && !*runAsConnector && !*runAsAgent {
 		log.Fatalln("must be run as one mode")
 	}
 
+	if *runAsServer && rawConfig != nil && rawConfig.Server.Listen != "" {
+		*listenAddr = rawConfig.Server.Listen
+	}
 	if *runAsServer && *listenAddr == "" {
 		log.Fatalln("server must set listen addr")
 	}
 
-	if *runAsConnector && (*serverEndpoint == "" || *remoteAddr == "") {
+	if *runAsConnector && (*serverEndpoint == "" || (*remoteAddr == "" && len(local.data) == 0)) {
 		if *serverEndpoint == "" {
 			log.Fatalln("connector must set server endpoint")
 		}
@@ -82,18 +169,76 @@ func main() {
 		}
 	}
 
-	if *runAsAgent && (*serverEndpoint == "") {
+	if *runAsAgent && rawConfig == nil && (*serverEndpoint == "") {
 		if *serverEndpoint == "" {
 			log.Fatalln("agent must set server endpoint")
 		}
 	}
 
+	if *vless && *uuid == "" && (*runAsConnector || *runAsAgent) && rawConfig == nil {
+		id, err := vlessproto.NewV4()
+		if err != nil {
+			log.Fatalln("%v", err)
+		}
+		*uuid = id.String()
+		log.Warnln("vless uuid is empty, use random uuid %v", *uuid)
+	}
+
 	if *runAsServer {
+		server := tcpover.NewServer()
 		app := http.Server{
-			Handler: tcpover.NewServer(),
+			Handler: server,
 			Addr:    *listenAddr,
 		}
 
+		if rawConfig != nil {
+			if len(rawConfig.Server.Users) > 0 {
+				users := make([]wss.User, 0, len(rawConfig.Server.Users))
+				for _, u := range rawConfig.Server.Users {
+					users = append(users, wss.User{Name: u.Name, Token: u.Token, Secret: u.Secret, Agents: u.Agents})
+				}
+				server.SetAuthenticator(wss.NewAuthenticator(users))
+			}
+			server.SetAdminSecret(rawConfig.Server.AdminSecret)
+			if err := server.SetUpgradeKey(rawConfig.Server.UpgradeKey); err != nil {
+				log.Fatalln("%v", err)
+			}
+			server.SetPairTimeout(time.Duration(rawConfig.Server.PairTimeout) * time.Second)
+			if err := server.SetAgentPolicy(rawConfig.Server.AgentPolicy); err != nil {
+				log.Fatalln("%v", err)
+			}
+			if acl := rawConfig.Server.ACL; acl != nil {
+				targetACL, err := rules.NewACL(acl.Allow, acl.Deny)
+				if err != nil {
+					log.Fatalln("%v", err)
+				}
+				server.SetACL(targetACL)
+			}
+			for _, agent := range rawConfig.Server.Agents {
+				if _, err := rules.NewACL(agent.Allow, agent.Deny); err != nil {
+					log.Fatalln("agent [%v]: %v", agent.Name, err)
+				}
+				server.SetAgentConfig(agent.Name, control.Config{
+					MaxLinks: agent.MaxLinks,
+					Allow:    agent.Allow,
+					Deny:     agent.Deny,
+				})
+				server.SetAgentReverse(agent.Name, agent.Reverse)
+			}
+			if len(rawConfig.Server.VlessUsers) > 0 {
+				accounts := make(map[string]string, len(rawConfig.Server.VlessUsers))
+				for _, u := range rawConfig.Server.VlessUsers {
+					accounts[u.Name] = u.UUID
+				}
+				users, err := vlessproto.NewUsers(accounts)
+				if err != nil {
+					log.Fatalln("%v", err)
+				}
+				server.SetVlessUsers(users)
+			}
+			serveExtra(server, rawConfig.Server)
+		}
+
 		go func() {
 			log.Infoln("addr %s tcpover service is starting...", *listenAddr)
 			if err := app.ListenAndServe(); err != nil {
@@ -104,12 +249,24 @@ func main() {
 		sigtermC := make(chan os.Signal, 1)
 		signal.Notify(sigtermC, os.Interrupt, syscall.SIGTERM, syscall.SIGABRT)
 
-		<-sigtermC // block until SIGTERM is received
-		log.Errorln("SIGTERM received: gracefully shutting down...")
+		var restart bool
+		select {
+		case <-sigtermC: // block until SIGTERM is received
+			log.Errorln("SIGTERM received: gracefully shutting down...")
+		case restart = <-server.Exit():
+			log.Errorln("admin exit received: gracefully shutting down, restart: %v", restart)
+		}
 
-		if err := app.Shutdown(context.Background()); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := app.Shutdown(shutdownCtx); err != nil {
 			log.Errorln("server shutdown error: %v", err)
 		}
+		if restart {
+			if err := tcpover.Reexec(); err != nil {
+				log.Errorln("restart error: %v", err)
+			}
+		}
 		return
 	}
 
@@ -153,10 +310,20 @@ func main() {
 		}
 
 		c := tcpover.NewClient(*serverEndpoint, nil)
+		if *user != "" {
+			c.SetAuth(&wss.Auth{User: *user, Token: *token, Secret: *secret})
+		}
+		c.SetUUID(*uuid)
 		_type := ctx.Wless
 		if *vless {
 			_type = ctx.Vless
 		}
+		if len(local.data) > 0 {
+			if err := c.Forward(local.data, _type, h.data, *mux); err != nil {
+				log.Fatalln("%v", err)
+			}
+			return
+		}
 		if err := c.Std(*remoteName, *remoteAddr, _type, h.data); err != nil {
 			log.Fatalln("%v", err)
 		}
@@ -165,6 +332,13 @@ func main() {
 
 	if *runAsAgent {
 		c := tcpover.NewClient(*serverEndpoint, nil)
+		if rawConfig != nil {
+			if err := c.Serve(*rawConfig); err != nil {
+				log.Fatalln("%v", err)
+			}
+			return
+		}
+
 		_type := ctx.Wless
 		if *vless {
 			_type = ctx.Vless
@@ -201,17 +375,32 @@ func main() {
 			"mode":   mode,
 			"mux":    *mux,
 			"header": h.data,
+			"user":   *user,
+			"token":  *token,
+			"secret": *secret,
+		}
+		if expose.data != nil {
+			proxying["services"] = expose.data
+		}
+		if len(*reverse) > 0 {
+			proxying["reverse"] = []string(*reverse)
+		}
+		if *acceptReverse {
+			proxying["accept-reverse"] = true
 		}
 		if _type == ctx.Vless {
-			proxying["uuid"] = time.Now().String()
+			proxying["uuid"] = *uuid
 		}
 
 		var proxies []map[string]interface{}
 		proxies = append(proxies, proxying)
 
+		// every connection of agent is sent by proxying. The connector(-c) does not use rules,
+		// it always connect the -addr or -L targets by server or the remote agent.
 		err := c.Serve(config.RawConfig{
 			Listen:  *listenAddr,
 			Proxies: proxies,
+			Rules:   []string{"MATCH,proxying"},
 		})
 		if err != nil {
 			log.Fatalln("%v", err)
@@ -219,3 +408,49 @@ func main() {
 		return
 	}
 }
+
+func serveExtra(server *tcpover.Server, conf config.Server) {
+	if conf.Shadowsocks != nil {
+		go func() {
+			ss := conf.Shadowsocks
+			log.Infoln("shadowsocks [%v] port %v is starting...", ss.Cipher, ss.Port)
+			if err := server.SS(context.Background(), ss.Port, ss.Cipher, ss.Password); err != nil {
+				log.Errorln("failed to start shadowsocks: %v", err)
+			}
+		}()
+	}
+
+	if conf.AnyTLS != nil {
+		go func() {
+			at := conf.AnyTLS
+			log.Infoln("anytls port %v is starting...", at.Port)
+			err := server.AnyTLS(context.Background(), at.Port, anytls.ServerConfig{
+				Password:      at.Password,
+				Certificate:   at.Certificate,
+				PrivateKey:    at.PrivateKey,
+				PaddingScheme: at.PaddingScheme,
+			})
+			if err != nil {
+				log.Errorln("failed to start anytls: %v", err)
+			}
+		}()
+	}
+
+	for _, v := range conf.Services {
+		go func(v config.Service) {
+			log.Infoln("service [%v] of agent [%v] on %v is starting...", v.Name, v.Agent, v.Listen)
+			if err := server.Service(context.Background(), v.Listen, v.Agent, v.Name); err != nil {
+				log.Errorln("failed to start service [%v]: %v", v.Name, err)
+			}
+		}(v)
+	}
+
+	if conf.VlessPort != 0 {
+		go func() {
+			log.Infoln("vless port %v is starting...", conf.VlessPort)
+			if err := server.TCPVless(context.Background(), conf.VlessPort); err != nil {
+				log.Errorln("failed to start vless: %v", err)
+			}
+		}()
+	}
+}
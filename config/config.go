@@ -1,7 +1,123 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 type RawConfig struct {
-	Listen  string
-	Proxies []map[string]interface{}
-	Rules   []string
+	Listen    string                   `yaml:"listen" json:"listen"`
+	Listeners []Listener               `yaml:"listeners" json:"listeners"`
+	Proxies   []map[string]interface{} `yaml:"proxies" json:"proxies"`
+	Groups    []map[string]interface{} `yaml:"proxy-groups" json:"proxy-groups"`
+	Rules     []string                 `yaml:"rules" json:"rules"`
+	Services  []Service                `yaml:"services" json:"services"`
+	Server    Server                   `yaml:"server" json:"server"`
+
+	// ExternalController is the listen address of RESTful API, Secret is the bearer token of it
+	ExternalController string `yaml:"external-controller" json:"external-controller"`
+	Secret             string `yaml:"secret" json:"secret"`
+
+	Path string `yaml:"-" json:"-"` // config file path, used by reload
+}
+
+// Service publish the service declared by agent on local listen address
+type Service struct {
+	Name   string `yaml:"name" json:"name"`
+	Agent  string `yaml:"agent" json:"agent"`
+	Listen string `yaml:"listen" json:"listen"`
+}
+
+// Listener is a local inbound, type is one of socks, http, mixed
+type Listener struct {
+	Type   string `yaml:"type" json:"type"`
+	Listen string `yaml:"listen" json:"listen"`
+}
+
+type Server struct {
+	Listen      string       `yaml:"listen" json:"listen"`
+	VlessPort   uint16       `yaml:"vless-port" json:"vless-port"`
+	Shadowsocks *Shadowsocks `yaml:"shadowsocks" json:"shadowsocks"`
+	AnyTLS      *AnyTLS      `yaml:"anytls" json:"anytls"`
+	Users       []User       `yaml:"users" json:"users"`
+	AdminSecret string       `yaml:"admin-secret" json:"admin-secret"`
+	UpgradeKey  string       `yaml:"upgrade-key" json:"upgrade-key"`   // hex ed25519 public key of upgrade binary
+	PairTimeout int          `yaml:"pair-timeout" json:"pair-timeout"` // second
+	VlessUsers  []VlessUser  `yaml:"vless-users" json:"vless-users"`
+	AgentPolicy string       `yaml:"agent-policy" json:"agent-policy"` // reject(default), round-robin, least-conn
+	ACL         *ACL         `yaml:"acl" json:"acl"`                   // target acl of direct mode
+	Agents      []Agent      `yaml:"agents" json:"agents"`             // config pushed to agents
+	Services    []Service    `yaml:"services" json:"services"`
+}
+
+// ACL is the allow and deny rules of target, eg: "IPCIDR,127.0.0.0/8", "DOMAIN-SUFFIX,lan", "DST-PORT,22"
+type ACL struct {
+	Allow []string `yaml:"allow" json:"allow"`
+	Deny  []string `yaml:"deny" json:"deny"`
+}
+
+// Agent is the config pushed to agents with name, Reverse is the addresses the agents are allowed to listen on,
+// connector/addr is the address on connector agent
+type Agent struct {
+	Name     string   `yaml:"name" json:"name"`
+	MaxLinks int      `yaml:"max-links" json:"max-links"`
+	Allow    []string `yaml:"allow" json:"allow"`
+	Deny     []string `yaml:"deny" json:"deny"`
+	Reverse  []string `yaml:"reverse" json:"reverse"`
+}
+
+// VlessUser is the allowed vless account, any uuid is accepted when there is no user
+type VlessUser struct {
+	Name string `yaml:"name" json:"name"`
+	UUID string `yaml:"uuid" json:"uuid"`
+}
+
+// User is the websocket user, authenticated by token or HMAC signature with secret
+type User struct {
+	Name   string   `yaml:"name" json:"name"`
+	Token  string   `yaml:"token" json:"token"`
+	Secret string   `yaml:"secret" json:"secret"`
+	Agents []string `yaml:"agents" json:"agents"` // agent names the user can register, empty allow any name
+}
+
+type Shadowsocks struct {
+	Port     uint16 `yaml:"port" json:"port"`
+	Cipher   string `yaml:"cipher" json:"cipher"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// Parse read config file, the format is decided by file extension: .json is JSON, others are YAML
+func Parse(path string) (*RawConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config RawConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &config)
+	default:
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config [%v]: %w", path, err)
+	}
+
+	config.Path = path
+	return &config, nil
+}
+
+// AnyTLS certificate and private-key are PEM content or file path, self-signed when empty
+type AnyTLS struct {
+	Port          uint16 `yaml:"port" json:"port"`
+	Password      string `yaml:"password" json:"password"`
+	Certificate   string `yaml:"certificate" json:"certificate"`
+	PrivateKey    string `yaml:"private-key" json:"private-key"`
+	PaddingScheme string `yaml:"padding-scheme" json:"padding-scheme"`
 }
@@ -1,9 +1,14 @@
 package ctx
 
 import (
+	"encoding/json"
+	"errors"
 	"net"
 )
 
+// ErrForbidden is the error of target which is not allowed to connect
+var ErrForbidden = errors.New("forbidden")
+
 type ConnContext interface {
 	Metadata() *Metadata
 	Conn() net.Conn
@@ -14,10 +19,21 @@ const (
 	HTTPCONNECT
 	SOCKS5
 	SHADOWSOCKS
+	ANYTLS
 )
 
 type Type int
 
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// Handshaker report the result of connecting target to client
+type Handshaker interface {
+	HandshakeSuccess() error
+	HandshakeFailure(err error) error
+}
+
 func (t Type) String() string {
 	switch t {
 	case HTTP:
@@ -28,6 +44,8 @@ func (t Type) String() string {
 		return "Socks5"
 	case SHADOWSOCKS:
 		return "ShadowSocks"
+	case ANYTLS:
+		return "AnyTLS"
 	default:
 		return "Unknown"
 	}
@@ -16,16 +16,36 @@ type Metadata struct {
 	DstPort uint16 `json:"destinationPort"`
 	Host    string `json:"host"`
 	Origin  string `json:"origin"`
+	User    string `json:"user"`
 }
 
 func (m *Metadata) RemoteAddress() string {
 	return net.JoinHostPort(m.String(), fmt.Sprintf("%v", m.DstPort))
 }
 
+// DialAddress return the address of resolved ip when DstIP is set, otherwise it is same as RemoteAddress.
+func (m *Metadata) DialAddress() string {
+	if m.DstIP != nil {
+		return net.JoinHostPort(m.DstIP.String(), fmt.Sprintf("%v", m.DstPort))
+	}
+	return m.RemoteAddress()
+}
+
 func (m *Metadata) SourceAddress() string {
 	return net.JoinHostPort(m.SrcIP.String(), fmt.Sprintf("%v", m.SrcPort))
 }
 
+// UDPAddr return the udp address of destination, nil if the destination is a domain
+func (m *Metadata) UDPAddr() *net.UDPAddr {
+	if m.NetWork != "udp" || m.DstIP == nil {
+		return nil
+	}
+	return &net.UDPAddr{
+		IP:   m.DstIP,
+		Port: int(m.DstPort),
+	}
+}
+
 func (m *Metadata) String() string {
 	if m.Host != "" {
 		return m.Host
@@ -0,0 +1,42 @@
+package ctx
+
+import (
+	"net"
+)
+
+type UDPPacket interface {
+	// Data get the payload of UDP Packet
+	Data() []byte
+
+	// WriteBack writes the payload with source IP/Port equals addr
+	// - variable source IP/Port is important to STUN
+	// - if addr is not provided, WriteBack will write out UDP packet with SourceIP/Port equals to original Target
+	WriteBack(b []byte, addr net.Addr) (n int, err error)
+
+	// Drop call after packet is used, could recycle buffer in this function.
+	Drop()
+
+	// LocalAddr returns the source IP/Port of packet
+	LocalAddr() net.Addr
+}
+
+type PacketAdapter interface {
+	UDPPacket
+	Metadata() *Metadata
+}
+
+type packetAdapter struct {
+	UDPPacket
+	metadata *Metadata
+}
+
+func (p *packetAdapter) Metadata() *Metadata {
+	return p.metadata
+}
+
+func NewPacketAdapter(packet UDPPacket, metadata *Metadata) PacketAdapter {
+	return &packetAdapter{
+		UDPPacket: packet,
+		metadata:  metadata,
+	}
+}
@@ -9,12 +9,31 @@ type Proxy interface {
 	Name() string
 	Type() ProxyType
 	DialContext(ctx context.Context, metadata *Metadata) (net.Conn, error)
+	ListenPacketContext(ctx context.Context, metadata *Metadata) (net.PacketConn, error)
+	SupportUDP() bool
+	// Close release the background resources of proxy, eg: mux sessions and agent connection
+	Close() error
+}
+
+// ProxyGroup is the proxy which select one of the wrapped proxies, Now is the name of selected one
+type ProxyGroup interface {
+	Proxy
+	Now() string
+	Proxies() []Proxy
 }
 
 type ProxyType = string
 
 const (
-	Wless  ProxyType = "Wless"
-	Vless  ProxyType = "Vless"
-	Direct ProxyType = "Direct"
+	Wless       ProxyType = "Wless"
+	Vless       ProxyType = "Vless"
+	Shadowsocks ProxyType = "Shadowsocks"
+	SSR         ProxyType = "SSR"
+	AnyTLS      ProxyType = "AnyTLS"
+	Direct      ProxyType = "Direct"
+
+	Selector    ProxyType = "Selector"
+	URLTest     ProxyType = "URLTest"
+	Fallback    ProxyType = "Fallback"
+	LoadBalance ProxyType = "LoadBalance"
 )
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package tcpover
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reexec replace current process with the executable, keep the args and environment.
+func Reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// replaceExecutable rename file over the executable, the running process keeps the old inode.
+func replaceExecutable(file, exe string) error {
+	return os.Rename(file, exe)
+}
@@ -0,0 +1,40 @@
+package tcpover
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Reexec start a new process with the executable and exit current process.
+func Reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// replaceExecutable move the running executable aside, it can be renamed but not be overwritten on windows,
+// then move file to the path of executable. The old one is restored on failure, and removed at next upgrade.
+func replaceExecutable(file, exe string) error {
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(file, exe); err != nil {
+		_ = os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
@@ -4,12 +4,14 @@ go 1.18
 
 require (
 	github.com/gorilla/websocket v1.5.3
+	github.com/hashicorp/yamux v0.1.1
 	github.com/sirupsen/logrus v1.9.3
 	github.com/tiechui1994/tool v1.5.18
 	github.com/xtaci/smux v1.5.57
 	golang.org/x/crypto v0.19.0
 	golang.org/x/net v0.17.0
 	golang.org/x/sys v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/text v0.14.0 // indirect
@@ -0,0 +1,182 @@
+package tcpover
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiechui1994/tcpover/transport/statistic"
+	"github.com/tiechui1994/tcpover/transport/wless"
+	"github.com/tiechui1994/tcpover/transport/wss"
+)
+
+// handshakeBuckets is the upper bounds(seconds) of handshake latency histogram
+var handshakeBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// handshakeModes is the mode label of handshake latency, the inbound of direct dialing or forward
+var handshakeModes = []string{"direct", "forward", "mux", "shadowsocks", "vless", "anytls"}
+
+var serverMetrics = newMetrics()
+
+type histogram struct {
+	mux    sync.Mutex
+	counts []uint64 // counts of each bucket, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	i := sort.SearchFloat64s(handshakeBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+type metrics struct {
+	active       map[string]*int64 // mode <=> active connections
+	dialFailures sync.Map          // reason <=> *uint64
+	handshake    map[string]*histogram
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		active:    map[string]*int64{},
+		handshake: map[string]*histogram{},
+	}
+	for _, mode := range []string{"direct", "forward", "mux"} {
+		m.active[mode] = new(int64)
+	}
+	for _, mode := range handshakeModes {
+		m.handshake[mode] = &histogram{counts: make([]uint64, len(handshakeBuckets)+1)}
+	}
+	return m
+}
+
+func modeLabel(mode wss.Mode) string {
+	switch {
+	case mode.IsMux():
+		return "mux"
+	case mode.IsDirect():
+		return "direct"
+	case mode.IsForward():
+		return "forward"
+	}
+	return ""
+}
+
+// connect count the active connection of mode, the returned func must be called when connection is closed.
+func (m *metrics) connect(mode wss.Mode) func() {
+	active, ok := m.active[modeLabel(mode)]
+	if !ok {
+		return func() {}
+	}
+	atomic.AddInt64(active, 1)
+	return func() {
+		atomic.AddInt64(active, -1)
+	}
+}
+
+func (m *metrics) dialFailure(reason string) {
+	reason = strings.ReplaceAll(reason, " ", "_")
+	value, _ := m.dialFailures.LoadOrStore(reason, new(uint64))
+	atomic.AddUint64(value.(*uint64), 1)
+}
+
+// dialError count the dial failure with the status of err
+func (m *metrics) dialError(err error) {
+	m.dialFailure(wless.StatusText(wless.ErrorStatus(err)))
+}
+
+// dial count the failure or observe the handshake latency of dialing target by inbound mode
+func (m *metrics) dial(mode string, start time.Time, err error) {
+	if err != nil {
+		m.dialError(err)
+		return
+	}
+	m.observeHandshake(mode, start)
+}
+
+func (m *metrics) observeHandshake(mode string, start time.Time) {
+	if h, ok := m.handshake[mode]; ok {
+		h.observe(time.Since(start).Seconds())
+	}
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (m *metrics) write(w io.Writer, s *Server) {
+	fmt.Fprintln(w, "# HELP tcpover_active_connections Number of active websocket connections by mode.")
+	fmt.Fprintln(w, "# TYPE tcpover_active_connections gauge")
+	for _, mode := range []string{"direct", "forward", "mux"} {
+		fmt.Fprintf(w, "tcpover_active_connections{mode=%q} %d\n", mode, atomic.LoadInt64(m.active[mode]))
+	}
+
+	agents := len(s.agents(""))
+	fmt.Fprintln(w, "# HELP tcpover_agents Number of registered manager agents.")
+	fmt.Fprintln(w, "# TYPE tcpover_agents gauge")
+	fmt.Fprintf(w, "tcpover_agents %d\n", agents)
+
+	s.groupMux.RLock()
+	pending := len(s.groupConn)
+	s.groupMux.RUnlock()
+	fmt.Fprintln(w, "# HELP tcpover_pending_pairs Number of forward connections waiting for the other side.")
+	fmt.Fprintln(w, "# TYPE tcpover_pending_pairs gauge")
+	fmt.Fprintf(w, "tcpover_pending_pairs %d\n", pending)
+
+	up, down := statistic.DefaultManager.Total()
+	fmt.Fprintln(w, "# HELP tcpover_relayed_bytes_total Bytes relayed by direction.")
+	fmt.Fprintln(w, "# TYPE tcpover_relayed_bytes_total counter")
+	fmt.Fprintf(w, "tcpover_relayed_bytes_total{direction=\"upload\"} %d\n", up)
+	fmt.Fprintf(w, "tcpover_relayed_bytes_total{direction=\"download\"} %d\n", down)
+
+	var reasons []string
+	m.dialFailures.Range(func(key, value interface{}) bool {
+		reasons = append(reasons, key.(string))
+		return true
+	})
+	sort.Strings(reasons)
+	fmt.Fprintln(w, "# HELP tcpover_dial_failures_total Failures of dialing target or agent by reason.")
+	fmt.Fprintln(w, "# TYPE tcpover_dial_failures_total counter")
+	for _, reason := range reasons {
+		value, _ := m.dialFailures.Load(reason)
+		fmt.Fprintf(w, "tcpover_dial_failures_total{reason=%q} %d\n", reason, atomic.LoadUint64(value.(*uint64)))
+	}
+
+	fmt.Fprintln(w, "# HELP tcpover_handshake_duration_seconds Latency of dialing target by inbound or pairing agent(forward).")
+	fmt.Fprintln(w, "# TYPE tcpover_handshake_duration_seconds histogram")
+	for _, mode := range handshakeModes {
+		h := m.handshake[mode]
+		h.mux.Lock()
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(handshakeBuckets) {
+				le = handshakeBuckets[i]
+			}
+			fmt.Fprintf(w, "tcpover_handshake_duration_seconds_bucket{mode=%q,le=%q} %d\n", mode, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "tcpover_handshake_duration_seconds_sum{mode=%q} %v\n", mode, h.sum)
+		fmt.Fprintf(w, "tcpover_handshake_duration_seconds_count{mode=%q} %d\n", mode, h.count)
+		h.mux.Unlock()
+	}
+}
+
+// Metrics export the server metrics in prometheus text format
+func (s *Server) Metrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	serverMetrics.write(w, s)
+}
@@ -0,0 +1,180 @@
+package tcpover
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/control"
+	"github.com/tiechui1994/tool/log"
+)
+
+// SetAgentReverse set the addresses which the agents of name are allowed to listen on,
+// the address is listened on server, or on the connector agent with format connector/addr.
+func (s *Server) SetAgentReverse(name string, addrs []string) {
+	s.manageMux.Lock()
+	defer s.manageMux.Unlock()
+	if len(addrs) == 0 {
+		delete(s.agentReverse, name)
+		return
+	}
+	s.agentReverse[name] = addrs
+}
+
+func (s *Server) reverseAllowed(name, addr string) bool {
+	s.manageMux.RLock()
+	defer s.manageMux.RUnlock()
+	return contains(s.agentReverse[name], addr)
+}
+
+// reverseListen open the listener of agent on server, or ask the connector agent to listen.
+// The accepted connection is linked to the service of agent, which is the target on agent network.
+func (s *Server) reverseListen(a *agent, listen control.Listen) error {
+	if !a.hasService(listen.Service) {
+		return fmt.Errorf("unknown service %v", listen.Service)
+	}
+	addr := listen.Addr
+	if listen.On != "" {
+		addr = listen.On + "/" + listen.Addr
+	}
+	if !s.reverseAllowed(a.name, addr) {
+		return fmt.Errorf("%w: listen %v not allowed", ctx.ErrForbidden, addr)
+	}
+
+	if listen.On != "" {
+		listen.Agent = a.name
+		s.addConnectorListen(listen)
+		for _, connector := range s.agents(listen.On) {
+			if !connector.acceptListen() {
+				continue
+			}
+			return connector.send(control.CommandListen, listen)
+		}
+		return fmt.Errorf("connector [%v]: %w", listen.On, ErrAgentUnavailable)
+	}
+
+	var listenConfig = net.ListenConfig{
+		Control: Control,
+	}
+	l, err := listenConfig.Listen(context.Background(), "tcp", listen.Addr)
+	if err != nil {
+		return err
+	}
+	if !a.addListener(l) {
+		_ = l.Close()
+		return fmt.Errorf("agent [%v] closed", a.name)
+	}
+
+	log.Infoln("agent [%v] reverse listen on %v => service [%v]", a.name, l.Addr(), listen.Service)
+	go s.serveService(l, a.name, listen.Service)
+	return nil
+}
+
+func (s *Server) handleListen(a *agent, msg *control.Message) {
+	var listen control.Listen
+	if err := msg.Decode(&listen); err != nil {
+		log.Errorln("agent [%v] %v", a.name, err)
+		return
+	}
+
+	ack := control.ListenAck{Addr: listen.Addr, On: listen.On}
+	if err := s.reverseListen(a, listen); err != nil {
+		log.Errorln("agent [%v] reverse listen %v: %v", a.name, listen.Addr, err)
+		ack.Error = err.Error()
+	}
+	if err := a.send(control.CommandListenAck, ack); err != nil {
+		log.Errorln("agent [%v] %v send listen ack: %v", a.name, a.addr, err)
+	}
+}
+
+// handleListenAck report the result of connector to the agents of reverse forward
+func (s *Server) handleListenAck(connector *agent, msg *control.Message) {
+	var ack control.ListenAck
+	if err := msg.Decode(&ack); err != nil {
+		log.Errorln("agent [%v] %v", connector.name, err)
+		return
+	}
+
+	if !s.hasConnectorListen(connector.name, ack) {
+		log.Errorln("connector [%v] %v ack unknown listen %v of agent [%v]", connector.name, connector.addr, ack.Addr, ack.Agent)
+		return
+	}
+
+	ack.On = connector.name
+	if ack.Error != "" {
+		log.Errorln("connector [%v] reverse listen %v of agent [%v]: %v", connector.name, ack.Addr, ack.Agent, ack.Error)
+	} else {
+		log.Infoln("connector [%v] reverse listen on %v => agent [%v]", connector.name, ack.Addr, ack.Agent)
+	}
+	for _, a := range s.agents(ack.Agent) {
+		if a.protocol() < 2 {
+			continue
+		}
+		if err := a.send(control.CommandListenAck, ack); err != nil {
+			log.Errorln("agent [%v] %v send listen ack: %v", a.name, a.addr, err)
+		}
+	}
+}
+
+func connectorListenKey(agent, addr string) string {
+	return agent + "/" + addr
+}
+
+// addConnectorListen record the listen sent to connector of listen.On
+func (s *Server) addConnectorListen(listen control.Listen) {
+	s.manageMux.Lock()
+	defer s.manageMux.Unlock()
+	listens, ok := s.connectorListen[listen.On]
+	if !ok {
+		listens = map[string]control.Listen{}
+		s.connectorListen[listen.On] = listens
+	}
+	listens[connectorListenKey(listen.Agent, listen.Addr)] = listen
+}
+
+// hasConnectorListen check the ack is the result of listen which is sent to connector
+func (s *Server) hasConnectorListen(connector string, ack control.ListenAck) bool {
+	s.manageMux.RLock()
+	defer s.manageMux.RUnlock()
+	_, ok := s.connectorListen[connector][connectorListenKey(ack.Agent, ack.Addr)]
+	return ok
+}
+
+// removeConnectorListen forget the listens of agent, it must be called with manageMux held
+func (s *Server) removeConnectorListen(agent string) {
+	for on, listens := range s.connectorListen {
+		for key, listen := range listens {
+			if listen.Agent == agent {
+				delete(listens, key)
+			}
+		}
+		if len(listens) == 0 {
+			delete(s.connectorListen, on)
+		}
+	}
+}
+
+// replayListen send the recorded listens to connector which registers again
+func (s *Server) replayListen(connector *agent) {
+	if !connector.acceptListen() {
+		return
+	}
+	s.manageMux.RLock()
+	listens := make([]control.Listen, 0, len(s.connectorListen[connector.name]))
+	for _, listen := range s.connectorListen[connector.name] {
+		listens = append(listens, listen)
+	}
+	s.manageMux.RUnlock()
+
+	for _, listen := range listens {
+		if !s.reverseAllowed(listen.Agent, listen.On+"/"+listen.Addr) {
+			continue
+		}
+		log.Infoln("connector [%v] replay reverse listen %v of agent [%v]", connector.name, listen.Addr, listen.Agent)
+		if err := connector.send(control.CommandListen, listen); err != nil {
+			log.Errorln("connector [%v] %v replay listen: %v", connector.name, connector.addr, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+// ACL check the target of connection with allow and deny rules, deny is checked first.
+// The target is allowed when allow is empty or one of allow is matched.
+type ACL struct {
+	allow     []Rule
+	deny      []Rule
+	resolveIP bool
+}
+
+// NewACL parse rules without adapter, eg: "IPCIDR,127.0.0.0/8", "DOMAIN-SUFFIX,lan", "DST-PORT,22/8000-9000"
+func NewACL(allow, deny []string) (*ACL, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	acl := &ACL{}
+	var err error
+	if acl.allow, err = acl.parse(allow); err != nil {
+		return nil, err
+	}
+	if acl.deny, err = acl.parse(deny); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func (a *ACL) parse(lines []string) ([]Rule, error) {
+	list := make([]Rule, 0, len(lines))
+	for _, line := range lines {
+		items := strings.Split(line, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		if len(items) < 2 || strings.EqualFold(items[0], RuleMatch) {
+			return nil, fmt.Errorf("acl rule [%s] format invalid", line)
+		}
+
+		rule, err := ParseRule(strings.ToUpper(items[0]), items[1], "", items[2:])
+		if err != nil {
+			return nil, fmt.Errorf("acl rule [%s]: %w", line, err)
+		}
+		if rule.ShouldResolveIP() {
+			a.resolveIP = true
+		}
+		list = append(list, rule)
+	}
+	return list, nil
+}
+
+// Check return error wrapped ctx.ErrForbidden when target of metadata is not allowed, nil ACL allow any target.
+// The domain is resolved when there is ip rule, and the resolved ip is set to DstIP, so dial with
+// metadata.DialAddress() to make sure the checked ip is connected.
+func (a *ACL) Check(metadata *ctx.Metadata) error {
+	if a == nil {
+		return nil
+	}
+
+	if metadata.DstIP == nil && metadata.Host != "" && a.resolveIP {
+		if ip := net.ParseIP(metadata.Host); ip != nil {
+			metadata.DstIP = ip
+		} else {
+			ips, err := resolve(metadata.Host)
+			if err != nil {
+				return err
+			}
+			// all ips of host must be allowed
+			for _, ip := range ips {
+				m := *metadata
+				m.DstIP = ip
+				if err := a.check(&m); err != nil {
+					return err
+				}
+			}
+			metadata.DstIP = ips[0]
+			return nil
+		}
+	}
+
+	return a.check(metadata)
+}
+
+func (a *ACL) check(metadata *ctx.Metadata) error {
+	for _, rule := range a.deny {
+		if ok, _ := rule.Match(metadata); ok {
+			return fmt.Errorf("%w: %v denied by %v,%v", ctx.ErrForbidden, metadata.RemoteAddress(), rule.Name(), rule.Payload())
+		}
+	}
+	if len(a.allow) == 0 {
+		return nil
+	}
+	for _, rule := range a.allow {
+		if ok, _ := rule.Match(metadata); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v not allowed", ctx.ErrForbidden, metadata.RemoteAddress())
+}
+
+func resolve(host string) ([]net.IP, error) {
+	ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ct, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("resolve %v: no address", host)
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
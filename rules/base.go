@@ -13,6 +13,8 @@ type Rule interface {
 	Name() string
 	Match(meta *ctx.Metadata) (bool, string)
 	Payload() string
+	ShouldResolveIP() bool
+	Adapter() string
 }
 
 const (
@@ -24,3 +26,16 @@ const (
 	RuleDstPort       = "DST-PORT"
 	RuleSrcPort       = "SRC-PORT"
 )
+
+const (
+	noResolve = "no-resolve"
+)
+
+func HasNoResolve(params []string) bool {
+	for _, p := range params {
+		if p == noResolve {
+			return true
+		}
+	}
+	return false
+}
@@ -32,3 +32,10 @@ func (d *Domain) Payload() string  {
 	return d.domain
 }
 
+func (d *Domain) ShouldResolveIP() bool {
+	return false
+}
+
+func (d *Domain) Adapter() string {
+	return d.adapter
+}
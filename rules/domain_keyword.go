@@ -32,4 +32,10 @@ func (d *DomainKeyword) Payload() string  {
 	return d.keyword
 }
 
+func (d *DomainKeyword) ShouldResolveIP() bool {
+	return false
+}
 
+func (d *DomainKeyword) Adapter() string {
+	return d.adapter
+}
@@ -32,3 +32,11 @@ func (d *DomainSuffix) Match(meta *ctx.Metadata) (bool, string) {
 func (d *DomainSuffix) Payload() string {
 	return d.suffix
 }
+
+func (d *DomainSuffix) ShouldResolveIP() bool {
+	return false
+}
+
+func (d *DomainSuffix) Adapter() string {
+	return d.adapter
+}
@@ -23,3 +23,11 @@ func (d *Match) Match(meta *ctx.Metadata) (bool, string) {
 func (d *Match) Payload() string {
 	return ""
 }
+
+func (d *Match) ShouldResolveIP() bool {
+	return false
+}
+
+func (d *Match) Adapter() string {
+	return d.adapter
+}
@@ -6,19 +6,21 @@ import (
 )
 
 type IPCIDR struct {
-	ipnet   *netip.Prefix
-	adapter string
+	ipnet       *netip.Prefix
+	adapter     string
+	noResolveIP bool
 }
 
-func NewIPCIDR(s string, adapter string) (*IPCIDR, error) {
+func NewIPCIDR(s string, adapter string, noResolveIP bool) (*IPCIDR, error) {
 	ipnet, err := netip.ParsePrefix(s)
 	if err != nil {
 		return nil, err
 	}
 
 	return &IPCIDR{
-		ipnet:   &ipnet,
-		adapter: adapter,
+		ipnet:       &ipnet,
+		adapter:     adapter,
+		noResolveIP: noResolveIP,
 	}, nil
 }
 
@@ -27,10 +29,21 @@ func (d *IPCIDR) Name() string {
 }
 
 func (d *IPCIDR) Match(meta *ctx.Metadata) (bool, string) {
-	ip := meta.DstIP
-	return d.ipnet.Contains(netip.MustParseAddr(ip.String())), d.adapter
+	ip, ok := netip.AddrFromSlice(meta.DstIP)
+	if !ok {
+		return false, d.adapter
+	}
+	return d.ipnet.Contains(ip.Unmap()), d.adapter
 }
 
 func (d *IPCIDR) Payload() string {
 	return d.ipnet.String()
 }
+
+func (d *IPCIDR) ShouldResolveIP() bool {
+	return !d.noResolveIP
+}
+
+func (d *IPCIDR) Adapter() string {
+	return d.adapter
+}
@@ -92,3 +92,11 @@ func (d *Port) Match(meta *ctx.Metadata) (bool, string) {
 func (d *Port) Payload() string {
 	return d.port
 }
+
+func (d *Port) ShouldResolveIP() bool {
+	return false
+}
+
+func (d *Port) Adapter() string {
+	return d.adapter
+}
@@ -12,7 +12,7 @@ func ParseRule(tp, payload, target string, params []string) (rule Rule, parseErr
 		rule = NewDomainSuffix(payload, target)
 		parseErr = nil
 	case RuleIPCIDR:
-		rule, parseErr = NewIPCIDR(payload, target)
+		rule, parseErr = NewIPCIDR(payload, target, HasNoResolve(params))
 	case RuleSrcPort:
 		rule, parseErr = NewPort(payload, target, RuleSrcPort)
 	case RuleDstPort:
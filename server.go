@@ -2,15 +2,15 @@ package tcpover
 
 import (
 	"context"
-	"crypto/sha1"
-	"encoding/hex"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -18,36 +18,63 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
+	"github.com/tiechui1994/tcpover/transport/anytls"
+	"github.com/tiechui1994/tcpover/transport/anytls/session"
 	"github.com/tiechui1994/tcpover/transport/common/bufio"
+	"github.com/tiechui1994/tcpover/transport/control"
 	"github.com/tiechui1994/tcpover/transport/inbound"
 	"github.com/tiechui1994/tcpover/transport/mux"
 	"github.com/tiechui1994/tcpover/transport/shadowsocks/core"
 	"github.com/tiechui1994/tcpover/transport/socks5"
+	"github.com/tiechui1994/tcpover/transport/statistic"
 	"github.com/tiechui1994/tcpover/transport/vless"
 	"github.com/tiechui1994/tcpover/transport/wless"
 	"github.com/tiechui1994/tcpover/transport/wss"
 	"github.com/tiechui1994/tool/log"
-	"github.com/tiechui1994/tool/util"
 )
 
 type PairGroup struct {
-	done chan struct{}
-	conn []net.Conn
+	done     chan struct{}
+	refuse   chan string // reason of agent declined the link
+	conn     []net.Conn
+	agent    int           // index of agent conn
+	metadata *ctx.Metadata // metadata of connector
+	user     string        // user allowed to join the pair
+	linked   *agent        // agent asked to join the pair, only it can refuse
+	start    time.Time
 }
 
 type Server struct {
-	manageConn sync.Map // addr <=> conn
-
-	groupMux  sync.RWMutex
-	groupConn map[string]*PairGroup // code <=> []conn
+	manageMux    sync.RWMutex
+	manageConn   map[string]*agentGroup // name <=> agents
+	agentPolicy  string
+	agentConfig  map[string]control.Config // name <=> config
+	agentReverse map[string][]string       // name <=> allowed reverse listen addresses
+	// listens sent to connector, they are replayed when connector registers again. connector <=> agent/addr <=> listen
+	connectorListen map[string]map[string]control.Listen
+
+	groupMux    sync.RWMutex
+	groupConn   map[string]*PairGroup // code <=> []conn
+	pairTimeout time.Duration
 
 	defaultHeader http.Header
 	upgrade       *websocket.Upgrader
 	conn          int32 // number of active connections
+	auth          wss.Authenticator
+	vlessUsers    *vless.Users
+	acl           *rules.ACL
+	adminSecret   string
+	upgradeKey    ed25519.PublicKey
+	upgradeMux    sync.Mutex
+	exit          chan bool // true: restart
 
 	date time.Time
 }
 
+// DefaultPairTimeout is the max time of waiting for the other side of forward connection
+const DefaultPairTimeout = 30 * time.Second
+
 func NewServer() *Server {
 	return &Server{
 		defaultHeader: map[string][]string{
@@ -60,28 +87,75 @@ func NewServer() *Server {
 				http.Error(w, http.StatusText(status), status)
 			},
 		},
-		groupConn: map[string]*PairGroup{},
-		date:      time.Now(),
+		manageConn:      map[string]*agentGroup{},
+		agentConfig:     map[string]control.Config{},
+		agentReverse:    map[string][]string{},
+		connectorListen: map[string]map[string]control.Listen{},
+		agentPolicy:     AgentPolicyReject,
+		groupConn:       map[string]*PairGroup{},
+		pairTimeout:     DefaultPairTimeout,
+		exit:            make(chan bool, 1),
+		date:            time.Now(),
+	}
+}
+
+// SetAuthenticator enable the authentication of websocket connection, nil disable it.
+func (s *Server) SetAuthenticator(auth wss.Authenticator) {
+	s.auth = auth
+}
+
+// SetPairTimeout set the max time of waiting for the other side of forward connection
+func (s *Server) SetPairTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.pairTimeout = timeout
+	}
+}
+
+func closeWithReason(socket *websocket.Conn, code int, reason string) {
+	// the control frame payload is at most 125 bytes
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	err := socket.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	if err != nil {
+		log.Debugln("write close [%v]: %v", reason, err)
+	}
+}
+
+// SetACL set the access control of target in direct mode, nil allow any target.
+func (s *Server) SetACL(acl *rules.ACL) {
+	s.acl = acl
+}
+
+// SetVlessUsers set the allowed vless users, nil accept any uuid.
+func (s *Server) SetVlessUsers(users *vless.Users) {
+	s.vlessUsers = users
+}
+
+func getNetwork(r *http.Request) string {
+	if r.URL.Query().Get("network") == "udp" {
+		return "udp"
 	}
+	return "tcp"
 }
 
-func (s *Server) getConnectConnAndAddr(r *http.Request, w http.ResponseWriter) (remote net.Conn, addr socks5.Addr, err error) {
+func (s *Server) getConnContext(r *http.Request, w http.ResponseWriter, user string) (cc ctx.ConnContext, err error) {
 	var socket *websocket.Conn
 	socket, err = s.upgrade.Upgrade(w, r, s.defaultHeader)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); !ok {
 			http.Error(w, fmt.Sprintf("upgrade error: %v", err), http.StatusInternalServerError)
 		}
-		return nil, nil, fmt.Errorf("upgrade error: %w", err)
+		return nil, fmt.Errorf("upgrade error: %w", err)
 	}
 
-	remote = wss.NewWebsocketConn(socket)
+	remote := wss.NewWebsocketConn(socket)
 	defer func() {
 		if err != nil {
 			remote.Close()
 			return
 		}
-		log.Debugln("connect addr: %v", addr)
+		log.Debugln("connect addr: %v, user: %v", cc.Metadata().RemoteAddress(), cc.Metadata().User)
 	}()
 
 	var proto = r.Header.Get("proto")
@@ -91,15 +165,48 @@ func (s *Server) getConnectConnAndAddr(r *http.Request, w http.ResponseWriter) (
 	log.Debugln("proto %v", proto)
 	switch proto {
 	case ctx.Vless:
-		addr, err = vless.ReadAddr(remote)
-		return remote, addr, err
+		var request *vless.Request
+		request, err = vless.ReadRequest(remote, s.vlessUsers)
+		if err != nil {
+			return nil, err
+		}
+		cc = inbound.NewSocket(request.Addr, remote, ctx.SHADOWSOCKS)
+		cc.Metadata().NetWork = request.Network()
+		if request.User != "" {
+			user = request.User
+		}
 	default:
-		addr, err = wless.ReadAddr(remote)
-		return remote, addr, err
+		var request *wless.Request
+		request, err = wless.ReadRequest(remote)
+		if err != nil {
+			return nil, err
+		}
+		cc = inbound.NewSocket(request.Addr, wless.NewServerConn(remote, request.Version), ctx.SHADOWSOCKS)
+		cc.Metadata().NetWork = getNetwork(r)
+	}
+	cc.Metadata().User = user
+	return cc, nil
+}
+
+// forwardMetadata return the metadata of forward connection, host is the name of agent.
+func forwardMetadata(user, remoteName string, r *http.Request) *ctx.Metadata {
+	metadata := &ctx.Metadata{
+		NetWork: getNetwork(r),
+		Type:    ctx.SHADOWSOCKS,
+		Host:    remoteName,
+		Origin:  r.Host,
+		User:    user,
+	}
+	if host, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		metadata.SrcIP = net.ParseIP(host)
+		if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+			metadata.SrcPort = uint16(p)
+		}
 	}
+	return metadata
 }
 
-func (s *Server) forwardConnect(remoteName, code string, mode wss.Mode, r *http.Request, w http.ResponseWriter) {
+func (s *Server) forwardConnect(user, remoteName, code string, mode wss.Mode, r *http.Request, w http.ResponseWriter) {
 	socket, err := s.upgrade.Upgrade(w, r, s.defaultHeader)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); !ok {
@@ -113,17 +220,12 @@ func (s *Server) forwardConnect(remoteName, code string, mode wss.Mode, r *http.
 
 	if code == "" && remoteName == "" {
 		log.Errorln("code and name is empty")
+		closeWithReason(socket, websocket.ClosePolicyViolation, "code and name is empty")
 		return
 	}
 
 	// active connection
 	if remoteName != "" {
-		manage, ok := s.manageConn.Load(remoteName)
-		if !ok {
-			log.Errorln("agent [%v] not running", remoteName)
-			return
-		}
-
 		var proto = ctx.Wless
 		if r.Header.Get("proto") == ctx.Vless {
 			proto = ctx.Vless
@@ -131,69 +233,221 @@ func (s *Server) forwardConnect(remoteName, code string, mode wss.Mode, r *http.
 			proto = ctx.Vless
 		}
 
-		code = time.Now().Format("20060102150405.9999")
-		data := map[string]interface{}{
-			"Code":    code,
-			"Network": "tcp",
-			"Mux":     mode.IsMux(),
-			"Proto":   proto,
+		link := control.Link{
+			Network: getNetwork(r),
+			Mux:     mode.IsMux(),
+			Proto:   proto,
+			Service: r.URL.Query().Get("service"),
 		}
-		_ = manage.(*websocket.Conn).WriteJSON(ControlMessage{
-			Command: CommandLink,
-			Data:    data,
-		})
+		err = s.linkAgent(conn, remoteName, link, forwardMetadata(user, remoteName, r))
+		if err != nil {
+			closeWithReason(socket, websocket.CloseTryAgainLater, err.Error())
+		}
+		return
+	}
+
+	if err = s.pair(code, user, nil, conn, nil, nil); err != nil {
+		closeWithReason(socket, websocket.CloseTryAgainLater, err.Error())
+	}
+}
+
+var linkSeq uint32
+
+// linkAgent ask the agent of name to connect server with link, then exchange data of conn and the agent conn.
+func (s *Server) linkAgent(conn net.Conn, name string, link control.Link, metadata *ctx.Metadata) error {
+	manage, err := s.pickAgent(name, &link)
+	if err != nil {
+		log.Errorln("agent [%v]: %v", name, err)
+		serverMetrics.dialFailure(err.Error())
+		return err
 	}
+	atomic.AddInt64(&manage.active, 1)
+	defer atomic.AddInt64(&manage.active, -1)
 
-	// 配对连接
+	link.Code = fmt.Sprintf("%v.%v", time.Now().Format("20060102150405.9999"), atomic.AddUint32(&linkSeq, 1))
+	// only the connection of agent user can join the pair
+	return s.pair(link.Code, manage.user, manage, conn, metadata, func() error {
+		err := manage.send(control.CommandLink, link)
+		if err != nil {
+			log.Errorln("agent [%v] link failure: %v", name, err)
+			serverMetrics.dialFailure("agent unreachable")
+			return errors.New("agent unreachable")
+		}
+		return nil
+	})
+}
+
+// pair exchange data of conn and the other conn with the same code, it waits the other side until timeout.
+// metadata is set by the connector of agent, and link is called to ask agent after the pair is registered,
+// so that the refusal of linked agent can find it. user is the one who can join the pair, others are refused.
+func (s *Server) pair(code, user string, linked *agent, conn net.Conn, metadata *ctx.Metadata, link func() error) error {
+	// 配对连接, 配对成功后从 groupConn 移除
 	s.groupMux.Lock()
 	if pair, ok := s.groupConn[code]; ok {
+		if pair.user != user {
+			s.groupMux.Unlock()
+			log.Errorln("pair [%v] refuse user: %v", code, user)
+			return errors.New("pair user mismatch")
+		}
+		delete(s.groupConn, code)
 		pair.conn = append(pair.conn, conn)
+		if metadata != nil {
+			pair.agent, pair.metadata = 0, metadata
+		}
 		s.groupMux.Unlock()
-
-		bufio.Relay(pair.conn[0], pair.conn[1], func(err error) {
+		serverMetrics.observeHandshake("forward", pair.start)
+
+		// 统计 agent 方向的流量, 读为下载, 写为上传
+		connector, agent := pair.conn[1-pair.agent], pair.conn[pair.agent]
+		if pair.metadata != nil {
+			info := statistic.NewTrackerInfo(pair.metadata, nil, nil)
+			info.Chain = []string{"forward", pair.metadata.Host}
+			agent = statistic.NewTCPTracker(agent, statistic.DefaultManager, info)
+		}
+		bufio.Relay(connector, agent, func(err error) {
 			close(pair.done)
+		})
+		return nil
+	}
+
+	pair := &PairGroup{
+		done:     make(chan struct{}),
+		refuse:   make(chan string, 1),
+		conn:     []net.Conn{conn},
+		agent:    1,
+		metadata: metadata,
+		user:     user,
+		linked:   linked,
+		start:    time.Now(),
+	}
+	s.groupConn[code] = pair
+	s.groupMux.Unlock()
+
+	if link != nil {
+		if err := link(); err != nil {
 			s.groupMux.Lock()
 			delete(s.groupConn, code)
 			s.groupMux.Unlock()
-		})
-	} else {
-		pair := &PairGroup{
-			done: make(chan struct{}),
-			conn: []net.Conn{conn},
+			return err
+		}
+	}
+
+	timer := time.NewTimer(s.pairTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-pair.done:
+			return nil
+		case reason := <-pair.refuse:
+			log.Errorln("agent refuse link [%v]: %v", code, reason)
+			serverMetrics.dialFailure("agent refused")
+			return fmt.Errorf("agent refused: %v", reason)
+		case <-timer.C:
+		}
+
+		s.groupMux.Lock()
+		if s.groupConn[code] != pair {
+			// paired or refused just now
+			s.groupMux.Unlock()
+			continue
 		}
-		s.groupConn[code] = pair
+		delete(s.groupConn, code)
 		s.groupMux.Unlock()
-		<-pair.done
+
+		log.Errorln("pair [%v] timeout after %v", code, s.pairTimeout)
+		serverMetrics.dialFailure("pair timeout")
+		return errors.New("pair timeout")
+	}
+}
+
+// refusePair close the pair of code which is declined by agent, the refusal of other agent is ignored
+func (s *Server) refusePair(a *agent, code, reason string) {
+	s.groupMux.Lock()
+	pair, ok := s.groupConn[code]
+	if ok && pair.linked != a {
+		s.groupMux.Unlock()
+		log.Errorln("agent [%v] %v refuse pair [%v] of other agent", a.name, a.addr, code)
+		return
+	}
+	if ok {
+		delete(s.groupConn, code)
+	}
+	s.groupMux.Unlock()
+	if ok {
+		pair.refuse <- reason
 	}
 }
 
-func (s *Server) directConnect(r *http.Request, w http.ResponseWriter) {
-	remote, addr, err := s.getConnectConnAndAddr(r, w)
+func (s *Server) directConnect(user string, r *http.Request, w http.ResponseWriter) {
+	cc, err := s.getConnContext(r, w, user)
 	if err != nil {
 		log.Errorln("%v", err)
 		return
 	}
-	defer remote.Close()
+	defer cc.Conn().Close()
 
-	cc := inbound.NewSocket(addr, remote, ctx.SHADOWSOCKS)
-	if mux.IsSpecialFqdn(cc.Metadata().Host) {
-		server := mux.NewServer()
-		err = server.NewConnection(remote)
+	s.relay(cc, "direct")
+}
+
+// relay connect to the target of cc and exchange data, the mux connection will be served by mux service.
+// The dial result is reported when conn of cc is a ctx.Handshaker. The traffic is tracked with the inbound name.
+func (s *Server) relay(cc ctx.ConnContext, inbound string) {
+	metadata := cc.Metadata()
+	handshaker, _ := cc.Conn().(ctx.Handshaker)
+	if mux.IsSpecialFqdn(metadata.Host) {
+		if handshaker != nil {
+			_ = handshaker.HandshakeSuccess()
+		}
+		server := mux.NewServer(s.acl.Check)
+		server.SetDialReporter(func(start time.Time, err error) {
+			serverMetrics.dial("mux", start, err)
+		})
+		err := server.NewConnection(cc.Conn(), metadata)
 		if err != nil && err != io.EOF {
 			log.Errorln("NewConnection: %v", err)
 		}
-	} else {
-		local, err := net.Dial("tcp", cc.Metadata().RemoteAddress())
+		return
+	}
+
+	remote := cc.Conn()
+	if metadata.NetWork == "udp" {
+		remote = bufio.NewPacketStreamConn(remote)
+	}
+	start := time.Now()
+	local, err := s.dialTarget(metadata)
+	serverMetrics.dial(inbound, start, err)
+	if handshaker != nil {
 		if err != nil {
-			log.Debugln("tcp connect [%v] : %v", addr, err)
-			return
+			_ = handshaker.HandshakeFailure(err)
+		} else {
+			_ = handshaker.HandshakeSuccess()
 		}
+	}
+	if err != nil {
+		return
+	}
 
-		bufio.Relay(local, remote, nil)
+	info := statistic.NewTrackerInfo(metadata, nil, nil)
+	info.Chain = []string{inbound}
+	local = statistic.NewTCPTracker(local, statistic.DefaultManager, info)
+	bufio.Relay(local, remote, nil)
+}
+
+// dialTarget connect the target of metadata which is allowed by acl
+func (s *Server) dialTarget(metadata *ctx.Metadata) (net.Conn, error) {
+	if err := s.acl.Check(metadata); err != nil {
+		log.Errorln("%v connect [%v] : %v", metadata.NetWork, metadata.RemoteAddress(), err)
+		return nil, err
+	}
+	local, err := net.Dial(metadata.NetWork, metadata.DialAddress())
+	if err != nil {
+		log.Debugln("%v connect [%v] : %v", metadata.NetWork, metadata.RemoteAddress(), err)
+		return nil, err
 	}
+	return local, nil
 }
 
-func (s *Server) manageConnect(name string, r *http.Request, w http.ResponseWriter) {
+func (s *Server) manageConnect(user, name string, r *http.Request, w http.ResponseWriter) {
 	conn, err := s.upgrade.Upgrade(w, r, s.defaultHeader)
 	if err != nil {
 		if _, ok := err.(websocket.HandshakeError); !ok {
@@ -204,20 +458,95 @@ func (s *Server) manageConnect(name string, r *http.Request, w http.ResponseWrit
 	}
 	defer conn.Close()
 
-	s.manageConn.Store(name, conn)
-	defer s.manageConn.Delete(name)
+	if s.auth != nil && !s.auth.AllowAgent(user, name) {
+		log.Errorln("agent [%v] is not allowed for user: %v", name, user)
+		closeWithReason(conn, websocket.ClosePolicyViolation, "agent name is not allowed")
+		return
+	}
+
+	manage := newAgent(name, user, r, conn)
+	if err := s.registerAgent(manage); err != nil {
+		log.Errorln("agent [%v] from %v: %v", name, manage.addr, err)
+		if err == ErrAgentUser {
+			closeWithReason(conn, websocket.ClosePolicyViolation, err.Error())
+			return
+		}
+		// the registered one may be a stale connection of the same agent, so it can try again later
+		closeWithReason(conn, websocket.CloseTryAgainLater, err.Error())
+		return
+	}
+	defer s.unregisterAgent(manage)
+	defer manage.closeListeners()
+	log.Infoln("agent [%v] registered from %v, version: %v", name, manage.addr, manage.version)
+
+	// read the message of agent, it also handle pong and close message.
+	// The agent is closed when nothing is received in agentTimeout.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg control.Message
+			if err := manage.refreshDeadline(); err != nil {
+				return
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				log.Debugln("agent [%v] read: %v", name, err)
+				return
+			}
+			s.handleAgentMessage(manage, &msg)
+		}
+	}()
 
-	ticker := time.NewTicker(time.Second * 10)
+	ticker := time.NewTicker(agentPingInterval)
 	defer ticker.Stop()
-	for range ticker.C {
-		err := conn.WriteJSON(ControlMessage{
-			Command: CommandPing,
-			Data:    map[string]interface{}{},
-		})
-		if wss.IsClose(err) {
-			log.Errorln("closing ..... : %v", conn.Close())
+	for {
+		select {
+		case <-done:
+			log.Errorln("agent [%v] closed", name)
+			return
+		case <-ticker.C:
+			err := manage.ping()
+			if err != nil {
+				log.Errorln("agent [%v] ping: %v", name, err)
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) handleAgentMessage(manage *agent, msg *control.Message) {
+	switch msg.Command {
+	case control.CommandHello:
+		var hello control.Hello
+		if err := msg.Decode(&hello); err != nil {
+			log.Errorln("agent [%v] %v", manage.name, err)
+			return
+		}
+		log.Infoln("agent [%v] hello, protocol: %v, protos: %v, mux: %v", manage.name, hello.Version, hello.Protos, hello.Mux)
+		s.agentHello(manage, &hello)
+	case control.CommandPong:
+		var pong control.Ping
+		if err := msg.Decode(&pong); err == nil {
+			manage.pong(pong.Time)
+		}
+	case control.CommandLinkAck:
+		var ack control.LinkAck
+		if err := msg.Decode(&ack); err != nil {
+			log.Errorln("agent [%v] %v", manage.name, err)
 			return
 		}
+		if !ack.Accept {
+			s.refusePair(manage, ack.Code, ack.Reason)
+		}
+	case control.CommandDrain:
+		log.Infoln("agent [%v] %v is draining", manage.name, manage.addr)
+		manage.setDraining()
+	case control.CommandListen:
+		s.handleListen(manage, msg)
+	case control.CommandListenAck:
+		s.handleListenAck(manage, msg)
+	default:
+		log.Debugln("agent [%v] unknown command: %v", manage.name, msg.Command)
 	}
 }
 
@@ -227,21 +556,28 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			s.Health(w, r)
 			return
 		}
-		if strings.HasSuffix(r.URL.Path, "/upgrade") {
-			s.Upgrade(w, r)
+		if strings.HasSuffix(r.URL.Path, "/metrics") {
+			s.Metrics(w, r)
 			return
 		}
 		if strings.HasSuffix(r.URL.Path, "/time") {
 			s.Time(w, r)
 			return
 		}
-
-		closed := r.URL.Query().Get("close")
-		if closed != "" {
-			s.Version(w, r)
-			time.AfterFunc(5*time.Second, func() {
-				os.Exit(0)
-			})
+		if strings.HasSuffix(r.URL.Path, "/admin/upgrade") {
+			s.admin(s.Upgrade)(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/admin/close") {
+			s.admin(s.Shutdown)(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/admin/agents") {
+			s.admin(s.AgentsHandler)(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/admin/connections") {
+			s.admin(s.Connections)(w, r)
 			return
 		}
 
@@ -249,6 +585,17 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var user string
+	if s.auth != nil {
+		var err error
+		user, err = s.auth.Authenticate(r)
+		if err != nil {
+			log.Errorln("authenticate [%v] failure: %v", r.RemoteAddr, err)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
 	name := r.URL.Query().Get("name")
 	code := r.URL.Query().Get("code")
 
@@ -256,7 +603,8 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	uuid := time.Now().Format("2006.0102.150405.9999")
 	atomic.AddInt32(&s.conn, +1)
-	log.Debugln("enter:%v, code:%v, name:%v, mode:%v", uuid, code, name, mode)
+	defer serverMetrics.connect(mode)()
+	log.Debugln("enter:%v, user:%v, code:%v, name:%v, mode:%v", uuid, user, code, name, mode)
 	defer func() {
 		atomic.AddInt32(&s.conn, -1)
 		log.Debugln("leave:%v  code:%v, name:%v, mode:%v", uuid, code, name, mode)
@@ -264,20 +612,20 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// 情况1: 直接连接
 	if mode.IsDirect() {
-		s.directConnect(r, w)
+		s.directConnect(user, r, w)
 		return
 	}
 
 	// 情况2: 主动连接方, 需要通过被动方
 	if mode.IsForward() {
-		s.forwardConnect(name, code, mode, r, w)
+		s.forwardConnect(user, name, code, mode, r, w)
 		return
 	}
 
 	// 情况3: 管理员通道
 	role := r.URL.Query().Get("rule")
 	if role == wss.RoleManager {
-		s.manageConnect(name, r, w)
+		s.manageConnect(user, name, r, w)
 		return
 	}
 }
@@ -307,55 +655,6 @@ func (s *Server) Time(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(raw)
 }
 
-func (s *Server) Upgrade(w http.ResponseWriter, r *http.Request) {
-	download := strings.TrimSpace(r.Header.Get("url"))
-	if !strings.HasPrefix(download, "http://") && !strings.HasPrefix(download, "https://") {
-		http.Error(w, "invalid download url", http.StatusBadRequest)
-		return
-	}
-
-	reader, err := util.File(download, "GET", util.WithRetry(2))
-	if err != nil {
-		http.Error(w, "download failure "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	pwd, _ := os.Executable()
-	oldPath := filepath.Join(filepath.Dir(pwd), "stream.backup")
-	fd, err := os.OpenFile(oldPath, os.O_EXCL|os.O_CREATE|os.O_RDWR, 0755)
-	if err != nil {
-		http.Error(w, "create temp file failure "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	hash := sha1.New()
-	readerToHash := io.TeeReader(reader, hash)
-
-	_, err = io.Copy(fd, readerToHash)
-	if err != nil {
-		http.Error(w, "download copy failure "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	err = os.Rename(oldPath, pwd)
-	if err != nil {
-		http.Error(w, "rename failure "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	_, _ = fmt.Fprint(w, hex.EncodeToString(hash.Sum(nil)))
-}
-
-type ControlMessage struct {
-	Command uint32
-	Data    map[string]interface{}
-}
-
-const (
-	CommandLink = 0x01
-	CommandPing = 0x02
-)
-
 func (s *Server) SS(ct context.Context, port uint16, name, password string) error {
 	var listenConfig = net.ListenConfig{
 		Control: Control,
@@ -382,28 +681,13 @@ func (s *Server) SS(ct context.Context, port uint16, name, password string) erro
 			}
 			go func() {
 				conn := cipher.StreamConn(conn)
+				defer conn.Close()
 				target, err := socks5.ReadAddr0(conn)
 				if err != nil {
-					_ = conn.Close()
 					return
 				}
 
-				cc := inbound.NewSocket(target, conn, ctx.SHADOWSOCKS)
-				if mux.IsSpecialFqdn(cc.Metadata().Host) {
-					server := mux.NewServer()
-					err = server.NewConnection(cc.Conn())
-					if err != nil && err != io.EOF {
-						log.Errorln("NewConnection: %v", err)
-					}
-				} else {
-					local, err := net.Dial("tcp", cc.Metadata().RemoteAddress())
-					if err != nil {
-						log.Debugln("tcp connect [%v] : %v", cc.Metadata().RemoteAddress(), err)
-						return
-					}
-
-					bufio.Relay(local, cc.Conn(), nil)
-				}
+				s.relay(inbound.NewSocket(target, conn, ctx.SHADOWSOCKS), "shadowsocks")
 			}()
 		}
 	}
@@ -429,29 +713,119 @@ func (s *Server) TCPVless(ct context.Context, port uint16) error {
 				continue
 			}
 			go func() {
-				addr, err := vless.ReadAddr(conn)
+				defer conn.Close()
+				request, err := vless.ReadRequest(conn, s.vlessUsers)
 				if err != nil {
-					_ = conn.Close()
+					log.Debugln("vless [%v] request: %v", conn.RemoteAddr(), err)
 					return
 				}
 
-				cc := inbound.NewSocket(addr, conn, ctx.SHADOWSOCKS)
-				if mux.IsSpecialFqdn(cc.Metadata().Host) {
-					server := mux.NewServer()
-					err = server.NewConnection(cc.Conn())
-					if err != nil && err != io.EOF {
-						log.Errorln("NewConnection: %v", err)
-					}
-				} else {
-					local, err := net.Dial("tcp", cc.Metadata().RemoteAddress())
-					if err != nil {
-						log.Debugln("tcp connect [%v] : %v", cc.Metadata().RemoteAddress(), err)
-						return
-					}
-
-					bufio.Relay(local, cc.Conn(), nil)
-				}
+				cc := inbound.NewSocket(request.Addr, conn, ctx.SHADOWSOCKS)
+				cc.Metadata().NetWork = request.Network()
+				cc.Metadata().User = request.User
+				s.relay(cc, "vless")
 			}()
 		}
 	}
 }
+
+func (s *Server) AnyTLS(ct context.Context, port uint16, config anytls.ServerConfig) error {
+	var listenConfig = net.ListenConfig{
+		Control: Control,
+	}
+
+	server, err := anytls.NewServer(config)
+	if err != nil {
+		return err
+	}
+
+	listen, err := listenConfig.Listen(ct, "tcp", fmt.Sprintf("0.0.0.0:%v", port))
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ct.Done()
+		_ = listen.Close()
+	}()
+
+	acceptLoop(listen, "anytls", func(conn net.Conn) {
+		err := server.NewConnection(conn, func(stream *session.Stream, target socks5.Addr) {
+			s.relay(inbound.NewSocket(target, stream, ctx.ANYTLS), "anytls")
+		})
+		if err != nil && err != io.EOF {
+			log.Debugln("anytls connection [%v]: %v", conn.RemoteAddr(), err)
+		}
+	})
+	return nil
+}
+
+// acceptLoop call handle with the accepted connection in new goroutine until listen is closed.
+// The accept error is retried with backoff like net/http, eg: too many open files.
+func acceptLoop(listen net.Listener, name string, handle func(conn net.Conn)) {
+	var delay time.Duration
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay *= 2; delay > time.Second {
+				delay = time.Second
+			}
+			log.Errorln("%v accept: %v, retrying in %v", name, err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+		go handle(conn)
+	}
+}
+
+// Service publish the service of agent on listen address, the connection is relayed to the agent service.
+func (s *Server) Service(ct context.Context, addr, agentName, service string) error {
+	var listenConfig = net.ListenConfig{
+		Control: Control,
+	}
+
+	listen, err := listenConfig.Listen(ct, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ct.Done()
+		_ = listen.Close()
+	}()
+
+	s.serveService(listen, agentName, service)
+	return nil
+}
+
+// serveService link the connection accepted by listen to service of agent until listen is closed
+func (s *Server) serveService(listen net.Listener, agentName, service string) {
+	addr := listen.Addr().String()
+	acceptLoop(listen, "service "+service, func(conn net.Conn) {
+		defer conn.Close()
+		metadata := &ctx.Metadata{
+			NetWork: "tcp",
+			Type:    ctx.SHADOWSOCKS,
+			Host:    agentName,
+			Origin:  addr,
+		}
+		if ip, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			metadata.SrcIP = net.ParseIP(ip)
+			if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+				metadata.SrcPort = uint16(p)
+			}
+		}
+		link := control.Link{
+			Network: "tcp",
+			Proto:   ctx.Wless,
+			Service: service,
+		}
+		if err := s.linkAgent(conn, agentName, link, metadata); err != nil {
+			log.Errorln("service [%v] of agent [%v]: %v", service, agentName, err)
+		}
+	})
+}
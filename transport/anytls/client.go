@@ -13,6 +13,7 @@ import (
 	"github.com/tiechui1994/tcpover/transport/anytls/padding"
 	"github.com/tiechui1994/tcpover/transport/anytls/session"
 	"github.com/tiechui1994/tcpover/transport/common/ca"
+	"github.com/tiechui1994/tcpover/transport/socks5"
 )
 
 type ClientConfig struct {
@@ -81,6 +82,21 @@ func (c *Client) createOutboundTLSConnection(ctx context.Context) (net.Conn, err
 	return tlsConn, nil
 }
 
+// CreateProxy open a stream and send the destination address, return stream as net.Conn
+func (c *Client) CreateProxy(ctx context.Context, destination socks5.Addr) (net.Conn, error) {
+	conn, err := c.sessionClient.CreateStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Write(destination)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
 func (c *Client) Close() error {
 	return c.sessionClient.Close()
 }
@@ -0,0 +1,101 @@
+package anytls
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"github.com/tiechui1994/tcpover/transport/anytls/padding"
+	"github.com/tiechui1994/tcpover/transport/anytls/session"
+	"github.com/tiechui1994/tcpover/transport/common/ca"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+)
+
+var errPassword = errors.New("anytls password incorrect")
+
+type ServerConfig struct {
+	Password string
+	// Certificate and PrivateKey are PEM content or file path, a random
+	// self-signed key pair will be generated when both are empty.
+	Certificate   string
+	PrivateKey    string
+	PaddingScheme string
+}
+
+// StreamHandler handle a proxy stream, target is the destination address sent by client
+type StreamHandler func(stream *session.Stream, target socks5.Addr)
+
+type Server struct {
+	passwordSha256 []byte
+	tlsConfig      *tls.Config
+	padding        atomic.Value
+}
+
+func NewServer(config ServerConfig) (*Server, error) {
+	cert, err := ca.LoadTLSKeyPair(readPEM(config.Certificate), readPEM(config.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	pw := sha256.Sum256([]byte(config.Password))
+	s := &Server{
+		passwordSha256: pw[:],
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		},
+	}
+
+	if config.PaddingScheme == "" || !padding.UpdatePaddingScheme([]byte(config.PaddingScheme), &s.padding) {
+		padding.UpdatePaddingScheme(padding.DefaultPaddingScheme, &s.padding)
+	}
+	return s, nil
+}
+
+func readPEM(value string) string {
+	if value == "" {
+		return value
+	}
+	if data, err := os.ReadFile(value); err == nil {
+		return string(data)
+	}
+	return value
+}
+
+// NewConnection verify the password hash of raw conn and run a server session, block until session closed
+func (s *Server) NewConnection(conn net.Conn, handler StreamHandler) error {
+	tlsConn := tls.Server(conn, s.tlsConfig)
+	defer tlsConn.Close()
+
+	// password(32) + paddingLen(2) + padding(N)
+	buf := make([]byte, 32+2)
+	_, err := io.ReadFull(tlsConn, buf)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(buf[:32], s.passwordSha256) != 1 {
+		return errPassword
+	}
+	if paddingLen := binary.BigEndian.Uint16(buf[32:]); paddingLen > 0 {
+		_, err = io.CopyN(io.Discard, tlsConn, int64(paddingLen))
+		if err != nil {
+			return err
+		}
+	}
+
+	sess := session.NewServerSession(tlsConn, func(stream *session.Stream) {
+		defer stream.Close()
+		target, err := socks5.ReadAddr0(stream)
+		if err != nil {
+			return
+		}
+		handler(stream, target)
+	}, &s.padding)
+	sess.Run()
+	return sess.Close()
+}
@@ -0,0 +1,72 @@
+package bufio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const maxPacketLength = 0xffff
+
+var errPacketTooLarge = errors.New("packet too large")
+
+// packetStreamConn transfer UDP datagram over stream connection, every packet is length(2) + payload.
+type packetStreamConn struct {
+	net.Conn
+	rMux sync.Mutex
+	wMux sync.Mutex
+}
+
+func NewPacketStreamConn(conn net.Conn) net.Conn {
+	return &packetStreamConn{Conn: conn}
+}
+
+// Read read one packet, the part beyond len(b) will be discarded
+func (c *packetStreamConn) Read(b []byte) (int, error) {
+	c.rMux.Lock()
+	defer c.rMux.Unlock()
+
+	var header [2]byte
+	_, err := io.ReadFull(c.Conn, header[:])
+	if err != nil {
+		return 0, err
+	}
+
+	length := int(binary.BigEndian.Uint16(header[:]))
+	n := length
+	if n > len(b) {
+		n = len(b)
+	}
+	_, err = io.ReadFull(c.Conn, b[:n])
+	if err != nil {
+		return 0, err
+	}
+	if length > n {
+		_, err = io.CopyN(io.Discard, c.Conn, int64(length-n))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Write write b as one packet
+func (c *packetStreamConn) Write(b []byte) (int, error) {
+	if len(b) > maxPacketLength {
+		return 0, errPacketTooLarge
+	}
+
+	c.wMux.Lock()
+	defer c.wMux.Unlock()
+
+	buf := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(buf, uint16(len(b)))
+	copy(buf[2:], b)
+	_, err := c.Conn.Write(buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -1,6 +1,7 @@
 package bufio
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -59,7 +60,10 @@ func Relay(leftConn, rightConn net.Conn, deferCall func(err error)) {
 		ch <- err
 	}()
 
-	_, _ = io.Copy(rightConn, leftConn)
+	_, leftErr := io.Copy(rightConn, leftConn)
 	_ = rightConn.SetReadDeadline(time.Now())
 	err = <-ch
+	if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		err = leftErr
+	}
 }
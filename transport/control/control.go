@@ -0,0 +1,107 @@
+package control
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Version is the control protocol version, agent without Hello is version 1 which only handle Link.
+const Version = 2
+
+const (
+	CommandLink    = 0x01 // server => agent, Link
+	CommandPing    = 0x02 // server => agent, Ping
+	CommandPong    = 0x03 // agent => server, Ping
+	CommandLinkAck = 0x04 // agent => server, LinkAck
+	CommandHello   = 0x05 // agent => server, Hello
+	CommandDrain   = 0x06 // server => agent ask to drain, agent => server report draining
+	CommandConfig  = 0x07 // server => agent, Config
+
+	CommandListen    = 0x08 // agent => server ask to listen, server => connector agent, Listen
+	CommandListenAck = 0x09 // answer of Listen, ListenAck
+)
+
+// Message is the frame of control channel, Data is the json of command payload.
+type Message struct {
+	Command uint32
+	Data    json.RawMessage
+}
+
+func NewMessage(command uint32, data interface{}) (*Message, error) {
+	if data == nil {
+		data = struct{}{}
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode command %v: %w", command, err)
+	}
+	return &Message{Command: command, Data: raw}, nil
+}
+
+func (m *Message) Decode(v interface{}) error {
+	if len(m.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return fmt.Errorf("decode command %v: %w", m.Command, err)
+	}
+	return nil
+}
+
+// Link ask agent to connect server with Code, the field names are same as version 1.
+type Link struct {
+	Code    string
+	Network string
+	Mux     bool
+	Proto   string
+	Service string `json:",omitempty"` // agent connect the published service and relay raw data
+}
+
+// LinkAck is the answer of Link, agent decline the link with Reason.
+type LinkAck struct {
+	Code   string
+	Accept bool
+	Reason string `json:",omitempty"`
+}
+
+// Ping carry the send time(unix nano) which is echoed by Pong
+type Ping struct {
+	Time int64
+}
+
+// Hello advertise the capability of agent
+type Hello struct {
+	Version  int
+	Protos   []string
+	Mux      bool
+	Services []string `json:",omitempty"` // names of published services
+	Listen   bool     `json:",omitempty"` // accept Listen from server, act as connector of reverse forward
+}
+
+// Drain stop the new links, agent close the control channel when the active links are done.
+type Drain struct {
+	Reason string `json:",omitempty"`
+}
+
+// Config is pushed by server to update the agent settings
+type Config struct {
+	MaxLinks int      // max active links, 0 is unlimited
+	Allow    []string `json:",omitempty"` // acl rules of target, see rules.NewACL
+	Deny     []string `json:",omitempty"`
+}
+
+// Listen ask to open listener on Addr, the accepted connection is linked to the Service of Agent.
+type Listen struct {
+	Addr    string
+	Service string
+	Agent   string `json:",omitempty"` // agent of Service, set by server when Listen is sent to connector
+	On      string `json:",omitempty"` // name of connector agent, empty is listen on server
+}
+
+// ListenAck is the result of Listen
+type ListenAck struct {
+	Addr  string
+	Agent string `json:",omitempty"`
+	On    string `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
@@ -0,0 +1,17 @@
+package inbound
+
+import (
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+)
+
+func NewPacket(target socks5.Addr, packet ctx.UDPPacket, source ctx.Type) ctx.PacketAdapter {
+	metadata := parseSocksAddr(target)
+	metadata.NetWork = "udp"
+	metadata.Type = source
+	if ip, port, err := parseAddr(packet.LocalAddr()); err == nil {
+		metadata.SrcIP = ip
+		metadata.SrcPort = uint16(port)
+	}
+	return ctx.NewPacketAdapter(packet, metadata)
+}
@@ -2,17 +2,21 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"hash/crc32"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
 	"github.com/tiechui1994/tcpover/transport/common/bufio"
 	"github.com/tiechui1994/tcpover/transport/listener/http"
 	"github.com/tiechui1994/tcpover/transport/listener/mixed"
 	"github.com/tiechui1994/tcpover/transport/listener/socks"
-	"github.com/tiechui1994/tool/log"
+	"github.com/tiechui1994/tcpover/transport/outbound"
+	"github.com/tiechui1994/tcpover/transport/statistic"
+	"github.com/tiechui1994/tcpover/transport/wless"
 )
 
 func preHandleMetadata(metadata *ctx.Metadata) error {
@@ -23,9 +27,48 @@ func preHandleMetadata(metadata *ctx.Metadata) error {
 	return nil
 }
 
-func resolveMetadata(metadata *ctx.Metadata) (ctx.Proxy, error) {
-	hash := crc32.ChecksumIEEE([]byte(metadata.Host))
-	return proxies[int(hash)%len(proxies)], nil
+func resolveIP(host string) (net.IP, error) {
+	c, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(c, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("can't resolve ip for domain: %s", host)
+	}
+	return ips[0], nil
+}
+
+// resolveMetadata match the rules with the snapshot of config, dns lookup is done without lock
+func resolveMetadata(metadata *ctx.Metadata) (ctx.Proxy, rules.Rule, error) {
+	configMux.RLock()
+	ruleList, proxies := ruleList, proxies
+	configMux.RUnlock()
+
+	var resolved bool
+	for _, rule := range ruleList {
+		if !resolved && rule.ShouldResolveIP() && metadata.Host != "" && metadata.DstIP == nil {
+			ip, err := resolveIP(metadata.Host)
+			if err != nil {
+				logDebugln("[DNS] resolve %s error: %s", metadata.Host, err)
+			} else {
+				logDebugln("[DNS] %s --> %s", metadata.Host, ip)
+				metadata.DstIP = ip
+			}
+			resolved = true
+		}
+
+		if ok, adapter := rule.Match(metadata); ok {
+			proxy, exist := proxies[adapter]
+			if !exist {
+				continue
+			}
+			return proxy, rule, nil
+		}
+	}
+
+	return proxies[outbound.NameDirect], nil, nil
 }
 
 func handleTCPConn(connCtx ctx.ConnContext) {
@@ -33,38 +76,61 @@ func handleTCPConn(connCtx ctx.ConnContext) {
 
 	metadata := connCtx.Metadata()
 	if !metadata.Valid() {
-		log.Warnln("[Metadata] not valid: %#v", metadata)
+		logWarnln("[Metadata] not valid: %#v", metadata)
 		return
 	}
 
 	if err := preHandleMetadata(metadata); err != nil {
-		log.Debugln("[Metadata PreHandle] error: %s", err)
+		logDebugln("[Metadata PreHandle] error: %s", err)
 		return
 	}
 
-	proxy, err := resolveMetadata(metadata)
+	proxy, rule, err := resolveMetadata(metadata)
 	if err != nil {
-		log.Warnln("[Metadata] parse failed: %s", err.Error())
+		logWarnln("[Metadata] parse failed: %s", err.Error())
 		return
 	}
+	if rule != nil {
+		logInfoln("[TCP] %s --> %s match %s(%s) using %s", metadata.SourceAddress(), metadata.RemoteAddress(), rule.Name(), rule.Payload(), proxy.Name())
+	} else {
+		logInfoln("[TCP] %s --> %s doesn't match any rule using %s", metadata.SourceAddress(), metadata.RemoteAddress(), proxy.Name())
+	}
 
 	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	remote, err := proxy.DialContext(c, metadata)
 	if err != nil {
-		log.Warnln("[TCP] dial %s --> %s error: %s", metadata.SourceAddress(), metadata.RemoteAddress(), err.Error())
+		logWarnln("[TCP] dial %s --> %s error: %s", metadata.SourceAddress(), metadata.RemoteAddress(), err.Error())
 		return
 	}
 
-	bufio.Relay(remote, connCtx.Conn(), nil)
+	remote = statistic.NewTCPTracker(remote, statistic.DefaultManager, statistic.NewTrackerInfo(metadata, rule, proxy))
+	bufio.Relay(remote, connCtx.Conn(), func(err error) {
+		var responseErr *wless.ResponseError
+		if errors.As(err, &responseErr) {
+			logWarnln("[TCP] dial %s --> %s error: %s", metadata.SourceAddress(), metadata.RemoteAddress(), responseErr.Error())
+		}
+	})
 }
 
 var (
-	proxies []ctx.Proxy
-	in      chan ctx.ConnContext
+	configMux sync.RWMutex
+	proxies   map[string]ctx.Proxy
+	// proxyConfigs is the config of proxies and groups applied by ApplyConfig, name <=> config
+	proxyConfigs map[string]map[string]interface{}
+	ruleList     []rules.Rule
+	listeners    map[string]string // type <=> addr
+
+	in chan ctx.ConnContext
 )
 
 func init() {
+	proxies = map[string]ctx.Proxy{
+		outbound.NameDirect: outbound.NewDirect(),
+	}
+
+	listeners = map[string]string{}
+
 	in = make(chan ctx.ConnContext, 100)
 	go func() {
 		for ctxConn := range in {
@@ -85,9 +151,74 @@ func RegisterListener(_type, addr string) error {
 	default:
 		err = fmt.Errorf("invalid type")
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	// socks5 udp associate relay on the same address
+	if _type == "socks" || _type == "mixed" {
+		_, err = socks.NewUDP(addr, udpIn)
+		if err != nil {
+			return err
+		}
+	}
+
+	configMux.Lock()
+	listeners[_type] = addr
+	configMux.Unlock()
+	return nil
 }
 
+// RegisterProxy add the proxy, the map is copied because it is read without lock by resolveMetadata
 func RegisterProxy(proxy ctx.Proxy) {
-	proxies = append(proxies, proxy)
+	configMux.Lock()
+	defer configMux.Unlock()
+	all := make(map[string]ctx.Proxy, len(proxies)+1)
+	for name, p := range proxies {
+		all[name] = p
+	}
+	all[proxy.Name()] = proxy
+	proxies = all
+}
+
+func RegisterRule(rule rules.Rule) {
+	configMux.Lock()
+	defer configMux.Unlock()
+	ruleList = append(ruleList, rule)
+}
+
+// Proxies return all registered proxies and proxy groups
+func Proxies() map[string]ctx.Proxy {
+	configMux.RLock()
+	defer configMux.RUnlock()
+	all := make(map[string]ctx.Proxy, len(proxies))
+	for name, proxy := range proxies {
+		all[name] = proxy
+	}
+	return all
+}
+
+// Rules return the registered rules in order
+func Rules() []rules.Rule {
+	configMux.RLock()
+	defer configMux.RUnlock()
+	return append([]rules.Rule{}, ruleList...)
+}
+
+// Listeners return the type and address of registered listeners
+func Listeners() map[string]string {
+	configMux.RLock()
+	defer configMux.RUnlock()
+	all := make(map[string]string, len(listeners))
+	for k, v := range listeners {
+		all[k] = v
+	}
+	return all
+}
+
+func lookupProxy(name string) (ctx.Proxy, bool) {
+	configMux.RLock()
+	defer configMux.RUnlock()
+	proxy, ok := proxies[name]
+	return proxy, ok
 }
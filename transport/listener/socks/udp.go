@@ -0,0 +1,115 @@
+package socks
+
+import (
+	"net"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/common/pool"
+	"github.com/tiechui1994/tcpover/transport/inbound"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+)
+
+type UDPListener struct {
+	packetConn net.PacketConn
+	addr       string
+	closed     bool
+}
+
+// RawAddress implements C.Listener
+func (l *UDPListener) RawAddress() string {
+	return l.addr
+}
+
+// Address implements C.Listener
+func (l *UDPListener) Address() string {
+	return l.packetConn.LocalAddr().String()
+}
+
+// Close implements C.Listener
+func (l *UDPListener) Close() error {
+	l.closed = true
+	return l.packetConn.Close()
+}
+
+func NewUDP(addr string, in chan<- ctx.PacketAdapter) (ctx.Listener, error) {
+	l, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sl := &UDPListener{
+		packetConn: l,
+		addr:       addr,
+	}
+	go func() {
+		for {
+			buf := pool.Get(pool.UDPBufferSize)
+			n, remoteAddr, err := l.ReadFrom(buf)
+			if err != nil {
+				_ = pool.Put(buf)
+				if sl.closed {
+					break
+				}
+				continue
+			}
+			handleSocksUDP(l, in, buf[:n], remoteAddr)
+		}
+	}()
+
+	return sl, nil
+}
+
+func handleSocksUDP(pc net.PacketConn, in chan<- ctx.PacketAdapter, buf []byte, addr net.Addr) {
+	target, payload, err := socks5.DecodeUDPPacket(buf)
+	if err != nil {
+		// Unresolved UDP packet, return buffer to the pool
+		_ = pool.Put(buf)
+		return
+	}
+	packet := &packet{
+		pc:      pc,
+		rAddr:   addr,
+		target:  append(socks5.Addr(nil), target...),
+		payload: payload,
+		bufRef:  buf,
+	}
+	select {
+	case in <- inbound.NewPacket(packet.target, packet, ctx.SOCKS5):
+	default:
+		packet.Drop()
+	}
+}
+
+type packet struct {
+	pc      net.PacketConn
+	rAddr   net.Addr
+	target  socks5.Addr
+	payload []byte
+	bufRef  []byte
+}
+
+func (c *packet) Data() []byte {
+	return c.payload
+}
+
+// WriteBack write UDP packet with source(ip, port) = `addr`
+func (c *packet) WriteBack(b []byte, addr net.Addr) (n int, err error) {
+	target := c.target
+	if addr != nil {
+		target = socks5.ParseAddrToSocksAddr(addr)
+	}
+	packet, err := socks5.EncodeUDPPacket(target, b)
+	if err != nil {
+		return
+	}
+	return c.pc.WriteTo(packet, c.rAddr)
+}
+
+// LocalAddr returns the source IP/Port of UDP Packet
+func (c *packet) LocalAddr() net.Addr {
+	return c.rAddr
+}
+
+func (c *packet) Drop() {
+	_ = pool.Put(c.bufRef)
+}
@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/tiechui1994/tool/log"
+)
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warning"
+	LevelError = "error"
+)
+
+// LogEvent is the log of connection pipeline which is published to subscribers
+type LogEvent struct {
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+}
+
+var (
+	logMux         sync.RWMutex
+	logSubscribers = map[chan LogEvent]struct{}{}
+)
+
+// SubscribeLogs return the channel of log events and the function to cancel it
+func SubscribeLogs() (<-chan LogEvent, func()) {
+	ch := make(chan LogEvent, 64)
+	logMux.Lock()
+	logSubscribers[ch] = struct{}{}
+	logMux.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			logMux.Lock()
+			delete(logSubscribers, ch)
+			logMux.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func publishLog(level, format string, args ...interface{}) {
+	logMux.RLock()
+	defer logMux.RUnlock()
+	if len(logSubscribers) == 0 {
+		return
+	}
+
+	event := LogEvent{Type: level, Payload: fmt.Sprintf(format, args...)}
+	for ch := range logSubscribers {
+		select {
+		case ch <- event:
+		default: // slow subscriber, drop
+		}
+	}
+}
+
+func logDebugln(format string, args ...interface{}) {
+	log.Debugln(format, args...)
+	publishLog(LevelDebug, format, args...)
+}
+
+func logInfoln(format string, args ...interface{}) {
+	log.Infoln(format, args...)
+	publishLog(LevelInfo, format, args...)
+}
+
+func logWarnln(format string, args ...interface{}) {
+	log.Warnln(format, args...)
+	publishLog(LevelWarn, format, args...)
+}
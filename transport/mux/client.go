@@ -2,44 +2,194 @@ package mux
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/tiechui1994/tcpover/ctx"
-	"github.com/xtaci/smux"
 )
 
+// DefaultMaxStreams is the max streams of session when neither MaxConnections nor MaxStreams is set
+const DefaultMaxStreams = 8
+
+// Option of mux client, same as sing-mux. MaxConnections conflicts with MaxStreams.
+type Option struct {
+	Protocol       byte
+	MaxConnections int           // max sessions, the least busy session is reused when it is reached
+	MinStreams     int           // min streams of session before opening new session, used with MaxConnections
+	MaxStreams     int           // max streams of session before opening new session
+	IdleTimeout    time.Duration // close the session without stream after timeout, 0 is never
+	Padding        bool
+}
+
 type Client struct {
-	pool   *sync.Map
+	option Option
 	dialer func() (net.Conn, error)
+
+	mux      sync.Mutex
+	sessions []*clientSession
+	dialing  chan struct{} // closed when the dialing session is done
+	reaping  bool
+	closed   bool
 }
 
-func NewClient(dialer func() (net.Conn, error)) *Client {
+type clientSession struct {
+	session
+	idleSince time.Time
+}
+
+// NewClient create mux client, dialer return the connection of new session
+func NewClient(option Option, dialer func() (net.Conn, error)) *Client {
+	// MinStreams only works with MaxConnections, the sessions must be bounded by MaxStreams without it
+	if option.MaxConnections == 0 && option.MaxStreams == 0 {
+		option.MaxStreams = DefaultMaxStreams
+	}
 	return &Client{
-		pool:   &sync.Map{},
+		option: option,
 		dialer: dialer,
 	}
 }
 
 func (c *Client) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
-	conn, err := c.openStream()
+	conn, err := c.openStream(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	network := metadata.NetWork
+	if network == "" {
+		network = "tcp"
+	}
+
 	// wrap mux Conn
-	return &clientConn{Conn: conn, destination: metadata.RemoteAddress()}, nil
+	return &clientConn{Conn: conn, network: network, destination: metadata.RemoteAddress()}, nil
 }
 
-func (c *Client) openStream() (net.Conn, error) {
-	conn, ok, err := openMuxConnectConn(c.pool)
-	if err != nil {
-		return nil, err
+// openStream open stream on the offered session. The new session is dialed without lock, only one
+// session is dialed at a time and the others wait it.
+func (c *Client) openStream(ctx context.Context) (net.Conn, error) {
+	for {
+		c.mux.Lock()
+		session, err := c.offer()
+		if err != nil {
+			c.mux.Unlock()
+			return nil, err
+		}
+		if session != nil {
+			conn, err := session.Open()
+			if err == nil {
+				session.idleSince = time.Time{}
+				c.mux.Unlock()
+				return conn, nil
+			}
+			// the session can not open stream any more, eg: smux.ErrGoAway
+			_ = session.Close()
+			c.remove(session)
+			c.mux.Unlock()
+			continue
+		}
+
+		if wait := c.dialing; wait != nil {
+			c.mux.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		c.dialing = make(chan struct{})
+		c.mux.Unlock()
+
+		session, err = c.dial(ctx)
+
+		c.mux.Lock()
+		close(c.dialing)
+		c.dialing = nil
+		if err != nil {
+			c.mux.Unlock()
+			return nil, err
+		}
+		if c.closed {
+			c.mux.Unlock()
+			_ = session.Close()
+			return nil, fmt.Errorf("mux client is closed")
+		}
+		c.sessions = append(c.sessions, session)
+		if !c.reaping {
+			c.reaping = true
+			go c.reap()
+		}
+		conn, err := session.Open()
+		c.mux.Unlock()
+		return conn, err
 	}
-	if ok {
-		return conn, nil
+}
+
+// offer return the session to open stream, nil means new session is required. It must be called with lock.
+func (c *Client) offer() (*clientSession, error) {
+	if c.closed {
+		return nil, fmt.Errorf("mux client is closed")
 	}
 
+	var selected *clientSession
+	for _, s := range c.sessions {
+		if s.IsClosed() || !s.CanTakeNewRequest() {
+			continue
+		}
+		if selected == nil || s.NumStreams() < selected.NumStreams() {
+			selected = s
+		}
+	}
+	c.removeClosed()
+	if selected == nil {
+		if c.option.MaxConnections > 0 && len(c.sessions) >= c.option.MaxConnections {
+			return nil, fmt.Errorf("mux sessions reach max connections %v", c.option.MaxConnections)
+		}
+		return nil, nil
+	}
+
+	numStreams := selected.NumStreams()
+	if numStreams == 0 {
+		return selected, nil
+	}
+	if c.option.MaxConnections > 0 {
+		if len(c.sessions) >= c.option.MaxConnections || numStreams < c.option.MinStreams {
+			return selected, nil
+		}
+	} else if c.option.MaxStreams > 0 && numStreams < c.option.MaxStreams {
+		return selected, nil
+	}
+	return nil, nil
+}
+
+// dial create new session, the session dialed after ctx is done is closed
+func (c *Client) dial(ctx context.Context) (*clientSession, error) {
+	type result struct {
+		session *clientSession
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		session, err := c.newSession()
+		done <- result{session: session, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.session, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				_ = r.session.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) newSession() (*clientSession, error) {
 	// create new mux conn
 	muxConn, err := c.dialer()
 	if err != nil {
@@ -47,45 +197,97 @@ func (c *Client) openStream() (net.Conn, error) {
 	}
 
 	// wrap proto conn
-	protoConn := &protocolConn{
-		Conn: muxConn,
-		request: Request{
-			Version:  0,
-			Protocol: 0,
-		},
-	}
-	session, err := newClientSession(protoConn, 0)
+	request := Request{
+		Version:  Version0,
+		Protocol: c.option.Protocol,
+	}
+	if c.option.Padding {
+		request.Version = Version1
+		request.Padding = true
+	}
+	var conn net.Conn = &protocolConn{
+		Conn:    muxConn,
+		request: request,
+	}
+	if request.Padding {
+		conn = newPaddingConn(conn)
+	}
+	session, err := newClientSession(conn, c.option.Protocol)
 	if err != nil {
-		protoConn.Close()
+		_ = conn.Close()
 		return nil, err
 	}
+	return &clientSession{session: session}, nil
+}
 
-	c.pool.Store(session, session)
-	return c.openStream()
+// Close close all sessions, the client can not open stream any more
+func (c *Client) Close() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closed = true
+	for _, s := range c.sessions {
+		_ = s.Close()
+	}
+	c.sessions = nil
+	return nil
 }
 
-func openMuxConnectConn(pool *sync.Map) (net.Conn, bool, error) {
-	var mux *smux.Session
-	pool.Range(func(key, value interface{}) bool {
-		session := value.(*smux.Session)
-		if session.IsClosed() || session.NumStreams() > 8 {
-			return true
+func (c *Client) remove(session *clientSession) {
+	for i, s := range c.sessions {
+		if s == session {
+			c.sessions = append(c.sessions[:i], c.sessions[i+1:]...)
+			return
 		}
-		mux = session
-		return false
-	})
+	}
+}
 
-	if mux == nil {
-		return nil, false, nil
+func (c *Client) removeClosed() {
+	sessions := c.sessions[:0]
+	for _, s := range c.sessions {
+		if !s.IsClosed() {
+			sessions = append(sessions, s)
+		}
 	}
+	for i := len(sessions); i < len(c.sessions); i++ {
+		c.sessions[i] = nil
+	}
+	c.sessions = sessions
+}
 
-	conn, err := mux.OpenStream()
-	if err != nil {
-		if err == smux.ErrGoAway {
-			return nil, false, nil
+// reap remove the closed sessions and close the idle sessions, it exits when there is no session
+func (c *Client) reap() {
+	interval := 30 * time.Second
+	if timeout := c.option.IdleTimeout; timeout > 0 && timeout/2 < interval {
+		interval = timeout / 2
+		if interval < time.Second {
+			interval = time.Second
 		}
-		return nil, false, err
 	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return conn, true, nil
+	for range ticker.C {
+		c.mux.Lock()
+		if timeout := c.option.IdleTimeout; timeout > 0 {
+			now := time.Now()
+			for _, s := range c.sessions {
+				if s.IsClosed() || s.NumStreams() > 0 {
+					s.idleSince = time.Time{}
+					continue
+				}
+				if s.idleSince.IsZero() {
+					s.idleSince = now
+				} else if now.Sub(s.idleSince) >= timeout {
+					_ = s.Close()
+				}
+			}
+		}
+		c.removeClosed()
+		if len(c.sessions) == 0 {
+			c.reaping = false
+			c.mux.Unlock()
+			return
+		}
+		c.mux.Unlock()
+	}
 }
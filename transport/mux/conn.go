@@ -36,9 +36,11 @@ func (c *serverConn) Close() error {
 
 type clientConn struct {
 	net.Conn
+	network        string
 	destination    string
 	requestWritten bool
 	responseRead   bool
+	responseErr    error
 }
 
 func (c *clientConn) readResponse() error {
@@ -48,20 +50,21 @@ func (c *clientConn) readResponse() error {
 		return err
 	}
 	if response.Status == statusError {
-		return fmt.Errorf("remote error: %v", response.Message)
+		err = fmt.Errorf("mux stream %v remote error: %v", c.destination, response.Message)
+		log.Errorln("client read mux status: %v", err)
+		return err
 	}
 	return nil
 }
 
 func (c *clientConn) Read(b []byte) (n int, err error) {
 	if !c.responseRead {
-		err = c.readResponse()
-		if err != nil {
-
-			return
-		}
+		c.responseErr = c.readResponse()
 		c.responseRead = true
 	}
+	if c.responseErr != nil {
+		return 0, c.responseErr
+	}
 	return c.Conn.Read(b)
 }
 
@@ -71,10 +74,13 @@ func (c *clientConn) Write(b []byte) (n int, err error) {
 	}
 
 	request := StreamRequest{
-		Network:     "tcp",
+		Network:     c.network,
 		Destination: c.destination,
 	}
-	data := EncodeStreamRequest(request)
+	data, err := EncodeStreamRequest(request)
+	if err != nil {
+		return 0, err
+	}
 	_, err = c.Conn.Write(append(data, b...))
 	if err != nil {
 		return
@@ -94,10 +100,10 @@ func (c *protocolConn) Write(p []byte) (n int, err error) {
 		return c.Conn.Write(p)
 	}
 	buffer := EncodeProtoRequest(c.request, p)
-	n, err = c.Conn.Write(buffer)
-	if err == nil {
-		n--
+	_, err = c.Conn.Write(buffer)
+	if err != nil {
+		return 0, err
 	}
 	c.requestWritten = true
-	return n, err
+	return len(p), nil
 }
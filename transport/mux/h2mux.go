@@ -0,0 +1,499 @@
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// h2mux open each stream as a CONNECT request of http2, it is compatible with sing-mux.
+
+const h2IdleTimeout = 30 * time.Second
+
+type h2MuxServerSession struct {
+	server  http2.Server
+	conn    net.Conn
+	active  int32
+	inbound chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newH2MuxServer(conn net.Conn) *h2MuxServerSession {
+	s := &h2MuxServerSession{
+		server:  http2.Server{IdleTimeout: h2IdleTimeout},
+		conn:    conn,
+		inbound: make(chan net.Conn),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		s.server.ServeConn(conn, &http2.ServeConnOpts{Handler: s})
+		_ = s.Close()
+	}()
+	return s
+}
+
+func (s *h2MuxServerSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.active, 1)
+	defer atomic.AddInt32(&s.active, -1)
+
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	writer := &flushWriter{writer: w, flusher: flusher}
+	defer writer.finish()
+	conn := newH2MuxConn(s.conn, writer)
+	conn.setup(r.Body, nil)
+	select {
+	case s.inbound <- conn:
+	case <-s.done:
+		return
+	}
+	select {
+	case <-conn.closed:
+	case <-s.done:
+		_ = conn.Close()
+	}
+}
+
+func (s *h2MuxServerSession) Open() (net.Conn, error) {
+	return nil, errors.New("h2mux server can not open stream")
+}
+
+func (s *h2MuxServerSession) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.inbound:
+		return conn, nil
+	case <-s.done:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+func (s *h2MuxServerSession) NumStreams() int {
+	return int(atomic.LoadInt32(&s.active))
+}
+
+func (s *h2MuxServerSession) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return s.conn.Close()
+}
+
+func (s *h2MuxServerSession) IsClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *h2MuxServerSession) CanTakeNewRequest() bool {
+	return false
+}
+
+type h2MuxClientSession struct {
+	conn       net.Conn
+	clientConn *http2.ClientConn
+}
+
+func newH2MuxClient(conn net.Conn) (*h2MuxClientSession, error) {
+	transport := &http2.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return conn, nil
+		},
+		ReadIdleTimeout: h2IdleTimeout,
+	}
+	clientConn, err := transport.NewClientConn(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &h2MuxClientSession{conn: conn, clientConn: clientConn}, nil
+}
+
+func (s *h2MuxClientSession) Open() (net.Conn, error) {
+	reader, writer := io.Pipe()
+	cx, cancel := context.WithCancel(context.Background())
+	request := (&http.Request{
+		Method: http.MethodConnect,
+		Body:   reader,
+		URL:    &url.URL{Scheme: "https", Host: "localhost"},
+	}).WithContext(cx)
+
+	conn := newH2MuxConn(s.conn, writer)
+	conn.cancel = cancel
+	go func() {
+		response, err := s.clientConn.RoundTrip(request)
+		if err == nil && response.StatusCode != http.StatusOK {
+			_ = response.Body.Close()
+			err = fmt.Errorf("unexpected status: %v", response.Status)
+		}
+		if err != nil {
+			_ = writer.CloseWithError(err)
+			conn.setup(nil, err)
+			return
+		}
+		conn.setup(response.Body, nil)
+	}()
+	return conn, nil
+}
+
+func (s *h2MuxClientSession) Accept() (net.Conn, error) {
+	return nil, errors.New("h2mux client can not accept stream")
+}
+
+func (s *h2MuxClientSession) NumStreams() int {
+	return s.clientConn.State().StreamsActive
+}
+
+func (s *h2MuxClientSession) Close() error {
+	return s.clientConn.Close()
+}
+
+func (s *h2MuxClientSession) IsClosed() bool {
+	state := s.clientConn.State()
+	return state.Closed || state.Closing
+}
+
+func (s *h2MuxClientSession) CanTakeNewRequest() bool {
+	return s.clientConn.CanTakeNewRequest()
+}
+
+// flushWriter write the response of server stream. The handler wait the in-flight writes before return,
+// because http2 panic when the response is written after the handler returned.
+type flushWriter struct {
+	writer  io.Writer
+	flusher http.Flusher
+
+	mux      sync.RWMutex // held by write
+	resetMux sync.Mutex   // held by reset, it is not blocked by write
+	done     bool         // the handler is returned, writer can not be used
+}
+
+func (w *flushWriter) Write(p []byte) (n int, err error) {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	if w.done {
+		return 0, io.ErrClosedPipe
+	}
+	n, err = w.writer.Write(p)
+	if err == nil && w.flusher != nil {
+		w.flusher.Flush()
+	}
+	return n, err
+}
+
+// reset the stream to break the blocked write
+func (w *flushWriter) reset() {
+	w.resetMux.Lock()
+	defer w.resetMux.Unlock()
+	if w.done {
+		return
+	}
+	if deadline, ok := w.writer.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		_ = deadline.SetWriteDeadline(time.Now())
+	}
+}
+
+// finish wait the in-flight writes and mark the writer done, it is called before the handler return
+func (w *flushWriter) finish() {
+	w.mux.Lock()
+	w.resetMux.Lock()
+	w.done = true
+	w.resetMux.Unlock()
+	w.mux.Unlock()
+}
+
+// pipeDeadline is the re-armable deadline like net.Pipe, expire is called with the closed cancel when the
+// deadline is exceeded, it may be called after the deadline is set again.
+type pipeDeadline struct {
+	mux    sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{} // closed when the deadline is exceeded
+	expire func(cancel chan struct{})
+}
+
+func makePipeDeadline(expire func(cancel chan struct{})) pipeDeadline {
+	return pipeDeadline{cancel: make(chan struct{}), expire: expire}
+}
+
+// set the deadline, zero t means no deadline. The exceeded deadline is refreshed by a future t.
+func (d *pipeDeadline) set(t time.Time) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait the timer callback close cancel
+	}
+	d.timer = nil
+
+	closed := isDone(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+			if d.expire != nil {
+				d.expire(cancel)
+			}
+		})
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+		if d.expire != nil {
+			// expire may call wait, it is called without d.mux
+			go d.expire(d.cancel)
+		}
+	}
+}
+
+func (d *pipeDeadline) wait() chan struct{} {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.cancel
+}
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// h2MuxConn is the stream of h2mux, the write of client is sent before the response is received.
+// The read deadline only interrupt Read, the write which is blocked when the deadline is exceeded
+// reset the stream, because the written bytes is unknown.
+type h2MuxConn struct {
+	conn   net.Conn
+	writer io.Writer
+	ready  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+	cancel context.CancelFunc
+
+	reader io.ReadCloser // set when ready
+	err    error
+
+	readMux  sync.Mutex
+	readCh   chan readResult
+	pumpOnce sync.Once
+	pending  []byte
+	readErr  error
+
+	writeMux      sync.Mutex
+	writing       int   // number of in-flight write, guarded by writeMux
+	aborted       int32 // the stream is reset
+	readDeadline  pipeDeadline
+	writeDeadline pipeDeadline
+}
+
+func newH2MuxConn(conn net.Conn, writer io.Writer) *h2MuxConn {
+	c := &h2MuxConn{
+		conn:         conn,
+		writer:       writer,
+		ready:        make(chan struct{}),
+		closed:       make(chan struct{}),
+		readCh:       make(chan readResult),
+		readDeadline: makePipeDeadline(nil),
+	}
+	c.writeDeadline = makePipeDeadline(c.resetWriting)
+	return c
+}
+
+func (c *h2MuxConn) setup(reader io.ReadCloser, err error) {
+	c.reader, c.err = reader, err
+	close(c.ready)
+	if reader != nil && atomic.LoadInt32(&c.aborted) == 1 {
+		_ = reader.Close()
+	}
+}
+
+// pump read the body in background, so that Read can return when the deadline is exceeded
+func (c *h2MuxConn) pump() {
+	for {
+		buf := make([]byte, 16*1024)
+		n, err := c.reader.Read(buf)
+		select {
+		case c.readCh <- readResult{data: buf[:n], err: err}:
+		case <-c.closed:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *h2MuxConn) Read(b []byte) (n int, err error) {
+	c.readMux.Lock()
+	defer c.readMux.Unlock()
+	if len(c.pending) > 0 {
+		n = copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	if c.readErr != nil {
+		return 0, c.readErr
+	}
+
+	select {
+	case <-c.ready:
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	case <-c.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.pumpOnce.Do(func() {
+		go c.pump()
+	})
+
+	select {
+	case result := <-c.readCh:
+		n = copy(b, result.data)
+		c.pending = result.data[n:]
+		if len(c.pending) > 0 {
+			c.readErr = result.err
+			return n, nil
+		}
+		return n, result.err
+	case <-c.closed:
+		return 0, io.ErrClosedPipe
+	case <-c.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *h2MuxConn) Write(b []byte) (n int, err error) {
+	c.writeMux.Lock()
+	select {
+	case <-c.closed:
+		c.writeMux.Unlock()
+		return 0, io.ErrClosedPipe
+	case <-c.writeDeadline.wait():
+		c.writeMux.Unlock()
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+	c.writing++
+	c.writeMux.Unlock()
+
+	n, err = c.writer.Write(b)
+	c.writeMux.Lock()
+	c.writing--
+	c.writeMux.Unlock()
+	if err != nil && isDone(c.writeDeadline.wait()) {
+		err = os.ErrDeadlineExceeded
+	}
+	return n, err
+}
+
+// resetWriting reset the stream when a write is in flight. expired is the cancel of exceeded write deadline,
+// it is ignored when the deadline is set again. nil means the conn is closed.
+func (c *h2MuxConn) resetWriting(expired chan struct{}) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	if expired != nil && c.writeDeadline.wait() != expired {
+		return
+	}
+	if c.writing > 0 {
+		c.reset()
+	}
+}
+
+// reset abort the stream. The client cancel the request before the response is received, or close the
+// response body which reset the stream and the request body. The server reset the response.
+func (c *h2MuxConn) reset() {
+	atomic.StoreInt32(&c.aborted, 1)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if writer, ok := c.writer.(interface{ reset() }); ok {
+		writer.reset()
+		return
+	}
+	if isDone(c.ready) && c.reader != nil {
+		_ = c.reader.Close()
+	}
+}
+
+func isDone(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *h2MuxConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.readDeadline.set(time.Time{})
+		c.writeDeadline.set(time.Time{})
+		// break the blocked write of server, the handler wait it before return
+		c.resetWriting(nil)
+		if closer, ok := c.writer.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		if c.cancel != nil {
+			c.cancel()
+		}
+		select {
+		case <-c.ready:
+			if c.reader != nil {
+				_ = c.reader.Close()
+			}
+		default:
+		}
+	})
+	return nil
+}
+
+func (c *h2MuxConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *h2MuxConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *h2MuxConn) SetDeadline(t time.Time) error {
+	_ = c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+func (c *h2MuxConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *h2MuxConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
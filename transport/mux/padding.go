@@ -0,0 +1,98 @@
+package mux
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+)
+
+// firstPaddings is the number of padded frames at the beginning of each direction, same as sing-mux
+const firstPaddings = 16
+
+// paddingConn pad the first frames with random length to hide the packet size of handshake,
+// the frame is: data length(2) + padding length(2) + data + padding
+type paddingConn struct {
+	net.Conn
+	readPadding      int
+	writePadding     int
+	readRemaining    int
+	paddingRemaining int
+}
+
+func newPaddingConn(conn net.Conn) net.Conn {
+	return &paddingConn{Conn: conn}
+}
+
+func (c *paddingConn) Read(p []byte) (n int, err error) {
+	if c.readRemaining > 0 {
+		if len(p) > c.readRemaining {
+			p = p[:c.readRemaining]
+		}
+		n, err = c.Conn.Read(p)
+		c.readRemaining -= n
+		return n, err
+	}
+	if c.paddingRemaining > 0 {
+		if _, err = io.CopyN(io.Discard, c.Conn, int64(c.paddingRemaining)); err != nil {
+			return 0, err
+		}
+		c.paddingRemaining = 0
+	}
+	if c.readPadding >= firstPaddings {
+		return c.Conn.Read(p)
+	}
+
+	var header [4]byte
+	if _, err = io.ReadFull(c.Conn, header[:]); err != nil {
+		return 0, err
+	}
+	dataLen := int(binary.BigEndian.Uint16(header[:2]))
+	paddingLen := int(binary.BigEndian.Uint16(header[2:]))
+	c.readPadding++
+	c.readRemaining = dataLen
+	c.paddingRemaining = paddingLen
+	if dataLen == 0 {
+		return c.Read(p)
+	}
+	if len(p) > dataLen {
+		p = p[:dataLen]
+	}
+	n, err = c.Conn.Read(p)
+	c.readRemaining -= n
+	return n, err
+}
+
+func (c *paddingConn) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		data := p
+		if len(data) > 65535 {
+			data = data[:65535]
+		}
+		var written int
+		written, err = c.write(data)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[len(data):]
+	}
+	return n, nil
+}
+
+func (c *paddingConn) write(p []byte) (n int, err error) {
+	if c.writePadding >= firstPaddings {
+		return c.Conn.Write(p)
+	}
+
+	paddingLen := 256 + rand.Intn(512)
+	buf := make([]byte, 4+len(p)+paddingLen)
+	binary.BigEndian.PutUint16(buf[:2], uint16(len(p)))
+	binary.BigEndian.PutUint16(buf[2:4], uint16(paddingLen))
+	copy(buf[4:], p)
+	c.writePadding++
+	if _, err = c.Conn.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"strconv"
 	"time"
@@ -45,6 +46,7 @@ func ReadByte(reader io.Reader) (byte, error) {
 type Request struct {
 	Version  byte
 	Protocol byte
+	Padding  bool // Version1 only
 }
 
 func ReadProtoRequest(reader io.Reader) (*Request, error) {
@@ -59,41 +61,42 @@ func ReadProtoRequest(reader io.Reader) (*Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Request{Version: version, Protocol: protocol}, nil
-}
-
-func EncodeProtoRequest(request Request, payload []byte) []byte {
-	buf := bytes.Buffer{}
-	buf.WriteByte(request.Version)
-	buf.WriteByte(request.Protocol)
-	buf.Write(payload)
-	return buf.Bytes()
-}
-
-func newServerSession(conn net.Conn, protocol byte) (*smux.Session, error) {
-	switch protocol {
-	case 0:
-		client, err := smux.Server(conn, &DefaultMuxConfig)
+	request := &Request{Version: version, Protocol: protocol}
+	if version == Version1 {
+		padding, err := ReadByte(reader)
 		if err != nil {
 			return nil, err
 		}
-		return client, nil
-	default:
-		return nil, fmt.Errorf("unexpected protocol %v", protocol)
+		request.Padding = padding != 0
+		if request.Padding {
+			var paddingLen uint16
+			if err = binary.Read(reader, binary.BigEndian, &paddingLen); err != nil {
+				return nil, err
+			}
+			if _, err = io.CopyN(io.Discard, reader, int64(paddingLen)); err != nil {
+				return nil, err
+			}
+		}
 	}
+	return request, nil
 }
 
-func newClientSession(conn net.Conn, protocol byte) (*smux.Session, error) {
-	switch protocol {
-	case 0:
-		client, err := smux.Client(conn, &DefaultMuxConfig)
-		if err != nil {
-			return nil, err
+func EncodeProtoRequest(request Request, payload []byte) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteByte(request.Version)
+	buf.WriteByte(request.Protocol)
+	if request.Version == Version1 {
+		if request.Padding {
+			paddingLen := 256 + rand.Intn(512)
+			buf.WriteByte(1)
+			binary.Write(&buf, binary.BigEndian, uint16(paddingLen))
+			buf.Write(make([]byte, paddingLen))
+		} else {
+			buf.WriteByte(0)
 		}
-		return client, nil
-	default:
-		return nil, fmt.Errorf("unexpected protocol %v", protocol)
 	}
+	buf.Write(payload)
+	return buf.Bytes()
 }
 
 const (
@@ -103,19 +106,26 @@ const (
 	statusError   = 1
 )
 
-func EncodeStreamRequest(request StreamRequest) []byte {
+func EncodeStreamRequest(request StreamRequest) ([]byte, error) {
 	buffer := bytes.Buffer{}
-	destination := request.Destination
 	var flags uint16
 	if request.Network == "udp" {
 		flags |= flagUDP
 	}
 	binary.Write(&buffer, binary.BigEndian, flags)
 
-	addr, port, _ := net.SplitHostPort(destination)
-	v, _ := strconv.Atoi(port)
-	writeAddrPort(&buffer, AtypDomainName, addr, uint16(v))
-	return buffer.Bytes()
+	addr, port, err := net.SplitHostPort(request.Destination)
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port of %v", request.Destination)
+	}
+	if err = writeAddrPort(&buffer, addr, uint16(v)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
 type StreamRequest struct {
@@ -123,17 +133,25 @@ type StreamRequest struct {
 	Destination string
 }
 
-func writeAddrPort(buf *bytes.Buffer, addrType byte, addr string, port uint16) {
-	buf.WriteByte(addrType)
-	switch addrType {
-	case AtypIPv4:
-		buf.WriteString(addr)
-		binary.Write(buf, binary.BigEndian, port)
-	case AtypDomainName:
+// writeAddrPort write the address in socks format, the type is detected from addr
+func writeAddrPort(buf *bytes.Buffer, addr string, port uint16) error {
+	if ip := net.ParseIP(addr); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			buf.WriteByte(AtypIPv4)
+			buf.Write(ip4)
+		} else {
+			buf.WriteByte(AtypIPv6)
+			buf.Write(ip.To16())
+		}
+	} else {
+		if len(addr) == 0 || len(addr) > 255 {
+			return fmt.Errorf("invalid domain length %v", len(addr))
+		}
+		buf.WriteByte(AtypDomainName)
 		buf.WriteByte(byte(len(addr)))
 		buf.WriteString(addr)
-		binary.Write(buf, binary.BigEndian, port)
 	}
+	return binary.Write(buf, binary.BigEndian, port)
 }
 
 func readAddrPort(conn io.Reader) (addr string, err error) {
@@ -171,6 +189,8 @@ func readAddrPort(conn io.Reader) (addr string, err error) {
 			return addr, err
 		}
 		addr = net.JoinHostPort(string(buf[:len(buf)-2]), fmt.Sprintf("%d", binary.BigEndian.Uint16(buf[len(buf)-2:])))
+	default:
+		return addr, fmt.Errorf("unsupported address type: %v", buf[0])
 	}
 
 	return addr, nil
@@ -195,6 +215,9 @@ func ReadStreamRequest(reader io.Reader) (*StreamRequest, error) {
 	return &StreamRequest{network, destination}, nil
 }
 
+// maxMessageSize is the max length of error message in stream response
+const maxMessageSize = 4096
+
 type StreamResponse struct {
 	Status  uint8
 	Message string
@@ -207,9 +230,45 @@ func ReadStreamResponse(reader io.Reader) (*StreamResponse, error) {
 		return nil, err
 	}
 	response.Status = status
+	if status == statusError {
+		size, err := binary.ReadUvarint(byteReader{reader})
+		if err != nil {
+			return nil, err
+		}
+		if size > maxMessageSize {
+			return nil, fmt.Errorf("stream response message too long: %v", size)
+		}
+		message := make([]byte, size)
+		if _, err = io.ReadFull(reader, message); err != nil {
+			return nil, err
+		}
+		response.Message = string(message)
+	}
 	return &response, nil
 }
 
+// EncodeStreamError encode the error response of stream, the message is prefixed with uvarint length
+// and truncated to maxMessageSize.
+func EncodeStreamError(err error) []byte {
+	message := err.Error()
+	if len(message) > maxMessageSize {
+		message = message[:maxMessageSize]
+	}
+	buf := make([]byte, 1+binary.MaxVarintLen64+len(message))
+	buf[0] = statusError
+	n := binary.PutUvarint(buf[1:], uint64(len(message)))
+	n += copy(buf[1+n:], message)
+	return buf[:1+n]
+}
+
+type byteReader struct {
+	io.Reader
+}
+
+func (r byteReader) ReadByte() (byte, error) {
+	return ReadByte(r.Reader)
+}
+
 func IsSpecialFqdn(fqdn string) bool {
 	switch fqdn {
 	case "sp.mux.sing-box.arpa", // mux
@@ -0,0 +1,119 @@
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStreamRequest(t *testing.T) {
+	tests := []struct {
+		request StreamRequest
+		atyp    byte
+	}{
+		{StreamRequest{Network: "tcp", Destination: "1.2.3.4:80"}, AtypIPv4},
+		{StreamRequest{Network: "tcp", Destination: "[2001:db8::1]:443"}, AtypIPv6},
+		{StreamRequest{Network: "tcp", Destination: "example.com:8080"}, AtypDomainName},
+		{StreamRequest{Network: "udp", Destination: "8.8.8.8:53"}, AtypIPv4},
+	}
+	for _, tt := range tests {
+		data, err := EncodeStreamRequest(tt.request)
+		if err != nil {
+			t.Fatalf("encode %v: %v", tt.request, err)
+		}
+		if data[2] != tt.atyp {
+			t.Errorf("encode %v: atyp %v, want %v", tt.request, data[2], tt.atyp)
+		}
+		request, err := ReadStreamRequest(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("read %v: %v", tt.request, err)
+		}
+		if *request != tt.request {
+			t.Errorf("read %v, want %v", *request, tt.request)
+		}
+	}
+}
+
+func TestStreamRequestInvalid(t *testing.T) {
+	for _, destination := range []string{"example.com", "example.com:65536", ":80", strings.Repeat("a", 256) + ":80"} {
+		if _, err := EncodeStreamRequest(StreamRequest{Network: "tcp", Destination: destination}); err == nil {
+			t.Errorf("encode %v: want error", destination)
+		}
+	}
+	if _, err := ReadStreamRequest(bytes.NewReader([]byte{0x00, 0x00, 0x05})); err == nil {
+		t.Errorf("read unsupported atyp: want error")
+	}
+}
+
+// TestStreamRequestSingMux check the bytes are same as the stream request of sing-mux
+func TestStreamRequestSingMux(t *testing.T) {
+	fixture := []byte{
+		0x00, 0x00, // flags
+		0x03, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', // domain
+		0x1f, 0x90, // port 8080
+	}
+	data, err := EncodeStreamRequest(StreamRequest{Network: "tcp", Destination: "example.com:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, fixture) {
+		t.Errorf("encode %x, want %x", data, fixture)
+	}
+
+	fixture = []byte{
+		0x00, 0x01, // flags udp
+		0x01, 0x08, 0x08, 0x04, 0x04, // ipv4
+		0x00, 0x35, // port 53
+	}
+	request, err := ReadStreamRequest(bytes.NewReader(fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Network != "udp" || request.Destination != "8.8.4.4:53" {
+		t.Errorf("read %v", *request)
+	}
+}
+
+func TestStreamResponse(t *testing.T) {
+	response, err := ReadStreamResponse(bytes.NewReader([]byte{statusSuccess}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != statusSuccess {
+		t.Errorf("status %v, want %v", response.Status, statusSuccess)
+	}
+
+	data := EncodeStreamError(errors.New("connection refused"))
+	if !bytes.Equal(data[:2], []byte{statusError, 18}) {
+		t.Errorf("encode %x", data)
+	}
+	response, err = ReadStreamResponse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != statusError || response.Message != "connection refused" {
+		t.Errorf("read %v", *response)
+	}
+
+	// long message is truncated
+	data = EncodeStreamError(errors.New(strings.Repeat("a", maxMessageSize+1)))
+	response, err = ReadStreamResponse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Message) != maxMessageSize {
+		t.Errorf("message length %v, want %v", len(response.Message), maxMessageSize)
+	}
+}
+
+func TestStreamResponseTooLong(t *testing.T) {
+	data := make([]byte, 1+binary.MaxVarintLen64)
+	data[0] = statusError
+	n := binary.PutUvarint(data[1:], 1<<40)
+	data = data[:1+n]
+	if _, err := ReadStreamResponse(bytes.NewReader(data)); err == nil {
+		t.Errorf("read too long message: want error")
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"io"
 	"net"
+	"strconv"
 	"time"
 	"unsafe"
 
 	"github.com/tiechui1994/tcpover/ctx"
 
 	"github.com/tiechui1994/tcpover/transport/common/bufio"
+	"github.com/tiechui1994/tcpover/transport/statistic"
 	"github.com/tiechui1994/tcpover/transport/wss"
 	"github.com/tiechui1994/tool/log"
 	"github.com/xtaci/smux"
@@ -22,8 +24,9 @@ type ServiceHandler interface {
 	NewConnection(ctx context.Context, conn net.Conn, meta *ctx.Metadata)
 }
 
-func NewServer() *Service {
-	return &Service{}
+// NewServer create mux service, check is called before dialing the target of stream, nil allow any target.
+func NewServer(check func(metadata *ctx.Metadata) error) *Service {
+	return &Service{check: check}
 }
 
 type frame struct {
@@ -33,9 +36,24 @@ type frame struct {
 	data []byte // payload
 }
 
-type Service struct{}
+type Service struct {
+	check  func(metadata *ctx.Metadata) error
+	report func(start time.Time, err error)
+}
+
+// SetDialReporter set the func called with the check and dial result of every stream
+func (s *Service) SetDialReporter(report func(start time.Time, err error)) {
+	s.report = report
+}
+
+func (s *Service) reportDial(start time.Time, err error) {
+	if s.report != nil {
+		s.report(start, err)
+	}
+}
 
-func (s *Service) NewConnection(conn net.Conn) error {
+// NewConnection serve the mux session on conn, metadata is the inbound info of conn which can be nil.
+func (s *Service) NewConnection(conn net.Conn, metadata *ctx.Metadata) error {
 	// read proto
 	request, err := ReadProtoRequest(conn)
 	if err != nil {
@@ -43,6 +61,10 @@ func (s *Service) NewConnection(conn net.Conn) error {
 		return err
 	}
 
+	if request.Padding {
+		conn = newPaddingConn(conn)
+	}
+
 	// new session with request
 	session, err := newServerSession(conn, request.Protocol)
 	if err != nil {
@@ -51,41 +73,13 @@ func (s *Service) NewConnection(conn net.Conn) error {
 	}
 	defer session.Close()
 
-	// hook code
-	go func() {
-		ticker := time.NewTicker(DefaultMuxConfig.KeepAliveInterval)
-		defer func() {
-			_ = recover()
-			ticker.Stop()
-		}()
-		
-		done := session.CloseChan()
-		frame := *(*smux.Frame)(unsafe.Pointer(&frame{
-			ver:  byte(DefaultMuxConfig.Version),
-			cmd:  3,
-			sid:  1,
-			data: make([]byte, 0),
-		}))
-		for {
-			select {
-			case <-ticker.C:
-				_, err := writeControlFrame(session, frame)
-				if err == io.ErrClosedPipe {
-					return
-				}
-			case <-done:
-				return
-			}
-		}
-	}()
+	if smuxSession, ok := session.(*smuxSession); ok {
+		go keepAlive(smuxSession.Session)
+	}
 
-	var stream net.Conn
 	for {
-		stream, err = session.AcceptStream()
-		if err != nil && err == smux.ErrTimeout {
-			continue
-		}
-		if wss.IsClose(err) {
+		stream, err := session.Accept()
+		if err != nil && (wss.IsClose(err) || session.IsClosed()) {
 			return nil
 		}
 		if err != nil {
@@ -93,21 +87,112 @@ func (s *Service) NewConnection(conn net.Conn) error {
 			return err
 		}
 
-		// read mux addr
-		request, err := ReadStreamRequest(stream)
-		if err != nil {
-			log.Errorln("read mux stream request: %v", err)
-			continue
+		go s.newStream(stream, metadata)
+	}
+}
+
+const (
+	streamRequestTimeout = 30 * time.Second
+	streamDialTimeout    = 10 * time.Second
+)
+
+// newStream read the request of stream, then connect the target and exchange data
+func (s *Service) newStream(stream net.Conn, metadata *ctx.Metadata) {
+	// read mux addr
+	_ = stream.SetReadDeadline(time.Now().Add(streamRequestTimeout))
+	request, err := ReadStreamRequest(stream)
+	if err != nil {
+		log.Errorln("read mux stream request: %v", err)
+		_ = stream.Close()
+		return
+	}
+	_ = stream.SetReadDeadline(time.Time{})
+
+	m := streamMetadata(metadata, request)
+	start := time.Now()
+	if s.check != nil {
+		if err := s.check(m); err != nil {
+			log.Errorln("mux check [%v]: %v", request.Destination, err)
+			s.reportDial(start, err)
+			writeStreamError(stream, err)
+			return
 		}
+	}
 
-		log.Debugln("mux dial connect: %v", request.Destination)
-		local, err := net.Dial(request.Network, request.Destination)
-		if err != nil {
-			log.Errorln("net dial: %v", err)
-			continue
+	log.Debugln("mux dial connect: %v", request.Destination)
+	local, err := net.DialTimeout(request.Network, m.DialAddress(), streamDialTimeout)
+	s.reportDial(start, err)
+	if err != nil {
+		log.Errorln("net dial: %v", err)
+		writeStreamError(stream, err)
+		return
+	}
+
+	var remote net.Conn = &serverConn{Conn: stream}
+	if request.Network == "udp" {
+		remote = bufio.NewPacketStreamConn(remote)
+	}
+	info := statistic.NewTrackerInfo(m, nil, nil)
+	info.Chain = []string{"mux"}
+	local = statistic.NewTCPTracker(local, statistic.DefaultManager, info)
+	bufio.Relay(local, remote, nil)
+}
+
+// writeStreamError tell client the stream is failed and close it
+func writeStreamError(stream net.Conn, err error) {
+	_ = stream.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, _ = stream.Write(EncodeStreamError(err))
+	_ = stream.Close()
+}
+
+// keepAlive send the keepalive frame which is required by mihomo
+func keepAlive(session *smux.Session) {
+	ticker := time.NewTicker(DefaultMuxConfig.KeepAliveInterval)
+	defer func() {
+		_ = recover()
+		ticker.Stop()
+	}()
+
+	done := session.CloseChan()
+	frame := *(*smux.Frame)(unsafe.Pointer(&frame{
+		ver:  byte(DefaultMuxConfig.Version),
+		cmd:  3,
+		sid:  1,
+		data: make([]byte, 0),
+	}))
+	for {
+		select {
+		case <-ticker.C:
+			_, err := writeControlFrame(session, frame)
+			if err == io.ErrClosedPipe {
+				return
+			}
+		case <-done:
+			return
 		}
+	}
+}
 
-		remote := &serverConn{Conn: stream}
-		go bufio.Relay(local, remote, nil)
+func streamMetadata(metadata *ctx.Metadata, request *StreamRequest) *ctx.Metadata {
+	m := &ctx.Metadata{NetWork: request.Network}
+	if metadata != nil {
+		m.Type = metadata.Type
+		m.SrcIP = metadata.SrcIP
+		m.SrcPort = metadata.SrcPort
+		m.Origin = metadata.Origin
+		m.User = metadata.User
+	}
+	host, port, err := net.SplitHostPort(request.Destination)
+	if err != nil {
+		return m
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		m.DstIP = ip
+	} else {
+		m.Host = host
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+		m.DstPort = uint16(p)
 	}
+	return m
 }
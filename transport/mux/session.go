@@ -0,0 +1,127 @@
+package mux
+
+import (
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/hashicorp/yamux"
+	"github.com/xtaci/smux"
+)
+
+// Protocol of mux session, same as sing-mux
+const (
+	ProtocolSmux  byte = 0
+	ProtocolYamux byte = 1
+	ProtocolH2Mux byte = 2
+)
+
+// ParseProtocol return the protocol of name, empty name is smux
+func ParseProtocol(name string) (byte, error) {
+	switch name {
+	case "", "smux":
+		return ProtocolSmux, nil
+	case "yamux":
+		return ProtocolYamux, nil
+	case "h2mux":
+		return ProtocolH2Mux, nil
+	default:
+		return 0, fmt.Errorf("unsupported mux protocol: %v", name)
+	}
+}
+
+// session is the mux session of smux, yamux and h2mux
+type session interface {
+	Open() (net.Conn, error)
+	Accept() (net.Conn, error)
+	NumStreams() int
+	Close() error
+	IsClosed() bool
+	CanTakeNewRequest() bool
+}
+
+func newServerSession(conn net.Conn, protocol byte) (session, error) {
+	switch protocol {
+	case ProtocolSmux:
+		server, err := smux.Server(conn, &DefaultMuxConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &smuxSession{Session: server}, nil
+	case ProtocolYamux:
+		server, err := yamux.Server(conn, yamuxConfig())
+		if err != nil {
+			return nil, err
+		}
+		return &yamuxSession{Session: server}, nil
+	case ProtocolH2Mux:
+		return newH2MuxServer(conn), nil
+	default:
+		return nil, fmt.Errorf("unexpected protocol %v", protocol)
+	}
+}
+
+func newClientSession(conn net.Conn, protocol byte) (session, error) {
+	switch protocol {
+	case ProtocolSmux:
+		client, err := smux.Client(conn, &DefaultMuxConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &smuxSession{Session: client}, nil
+	case ProtocolYamux:
+		client, err := yamux.Client(conn, yamuxConfig())
+		if err != nil {
+			return nil, err
+		}
+		return &yamuxSession{Session: client}, nil
+	case ProtocolH2Mux:
+		return newH2MuxClient(conn)
+	default:
+		return nil, fmt.Errorf("unexpected protocol %v", protocol)
+	}
+}
+
+type smuxSession struct {
+	*smux.Session
+}
+
+func (s *smuxSession) Open() (net.Conn, error) {
+	return s.OpenStream()
+}
+
+func (s *smuxSession) Accept() (net.Conn, error) {
+	for {
+		stream, err := s.AcceptStream()
+		if err == smux.ErrTimeout {
+			continue
+		}
+		return stream, err
+	}
+}
+
+func (s *smuxSession) CanTakeNewRequest() bool {
+	return true
+}
+
+func yamuxConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.LogOutput = io.Discard
+	return config
+}
+
+type yamuxSession struct {
+	*yamux.Session
+}
+
+func (s *yamuxSession) Open() (net.Conn, error) {
+	return s.OpenStream()
+}
+
+func (s *yamuxSession) Accept() (net.Conn, error) {
+	return s.AcceptStream()
+}
+
+func (s *yamuxSession) CanTakeNewRequest() bool {
+	return true
+}
@@ -0,0 +1,68 @@
+package outbound
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/anytls"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+)
+
+type AnyTLSOption struct {
+	Name                     string   `proxy:"name"`
+	Server                   string   `proxy:"server"`
+	Port                     int      `proxy:"port"`
+	Password                 string   `proxy:"password"`
+	SNI                      string   `proxy:"sni,omitempty"`
+	ALPN                     []string `proxy:"alpn,omitempty"`
+	SkipCertVerify           bool     `proxy:"skip-cert-verify,omitempty"`
+	Fingerprint              string   `proxy:"fingerprint,omitempty"`
+	IdleSessionCheckInterval int      `proxy:"idle-session-check-interval,omitempty"`
+	IdleSessionTimeout       int      `proxy:"idle-session-timeout,omitempty"`
+	MinIdleSession           int      `proxy:"min-idle-session,omitempty"`
+}
+
+type AnyTLS struct {
+	*base
+	client *anytls.Client
+}
+
+func NewAnyTLS(option AnyTLSOption) (ctx.Proxy, error) {
+	sni := option.SNI
+	if sni == "" {
+		sni = option.Server
+	}
+
+	client := anytls.NewClient(context.Background(), anytls.ClientConfig{
+		Password:                 option.Password,
+		IdleSessionCheckInterval: time.Duration(option.IdleSessionCheckInterval) * time.Second,
+		IdleSessionTimeout:       time.Duration(option.IdleSessionTimeout) * time.Second,
+		MinIdleSession:           option.MinIdleSession,
+		Server:                   net.JoinHostPort(option.Server, strconv.Itoa(option.Port)),
+		TLSConfig: &anytls.TLSConfig{
+			Host:           sni,
+			SkipCertVerify: option.SkipCertVerify,
+			FingerPrint:    option.Fingerprint,
+			NextProtos:     option.ALPN,
+		},
+	})
+
+	return &AnyTLS{
+		base: &base{
+			name:      option.Name,
+			proxyType: ctx.AnyTLS,
+		},
+		client: client,
+	}, nil
+}
+
+func (p *AnyTLS) Close() error {
+	return p.client.Close()
+}
+
+func (p *AnyTLS) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	return p.client.CreateProxy(ctx, socks5.ParseAddr(metadata.RemoteAddress()))
+}
@@ -11,6 +11,7 @@ import (
 type base struct {
 	name      string
 	proxyType ctx.ProxyType
+	udp       bool
 }
 
 func (p *base) Name() string {
@@ -24,3 +25,15 @@ func (p *base) Type() string {
 func (p *base) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
 	return nil, fmt.Errorf("not support")
 }
+
+func (p *base) SupportUDP() bool {
+	return p.udp
+}
+
+func (p *base) Close() error {
+	return nil
+}
+
+func (p *base) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	return nil, fmt.Errorf("not support")
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/tiechui1994/tcpover/ctx"
 )
 
+const NameDirect = "DIRECT"
+
 type Direct struct {
 	*base
 }
@@ -14,8 +16,9 @@ type Direct struct {
 func NewDirect() ctx.Proxy {
 	return &Direct{
 		base: &base{
-			name:      "DIRECT",
+			name:      NameDirect,
 			proxyType: ctx.Direct,
+			udp:       true,
 		},
 	}
 }
@@ -24,3 +27,12 @@ func (p *Direct) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.C
 	var d net.Dialer
 	return d.DialContext(ctx, "tcp", metadata.RemoteAddress())
 }
+
+func (p *Direct) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", metadata.RemoteAddress())
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(conn, metadata), nil
+}
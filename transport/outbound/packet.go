@@ -0,0 +1,31 @@
+package outbound
+
+import (
+	"net"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+// packetConn adapt a connection which Read/Write whole datagram to net.PacketConn.
+// The destination is fixed when connection created, so the addr of WriteTo is ignored.
+type packetConn struct {
+	net.Conn
+	rAddr net.Addr
+}
+
+func newPacketConn(conn net.Conn, metadata *ctx.Metadata) net.PacketConn {
+	pc := &packetConn{Conn: conn}
+	if addr := metadata.UDPAddr(); addr != nil {
+		pc.rAddr = addr
+	}
+	return pc
+}
+
+func (c *packetConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	n, err = c.Conn.Read(b)
+	return n, c.rAddr, err
+}
+
+func (c *packetConn) WriteTo(b []byte, _ net.Addr) (n int, err error) {
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,146 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/common/bufio"
+	"github.com/tiechui1994/tcpover/transport/common/pool"
+	"github.com/tiechui1994/tcpover/transport/mux"
+	"github.com/tiechui1994/tcpover/transport/shadowsocks/core"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+)
+
+type ShadowsocksOption struct {
+	Name     string `proxy:"name"`
+	Server   string `proxy:"server"`
+	Port     int    `proxy:"port"`
+	Cipher   string `proxy:"cipher"`
+	Password string `proxy:"password"`
+	Mux      bool   `proxy:"mux,omitempty"`
+}
+
+type Shadowsocks struct {
+	*base
+	addr      string
+	mux       bool
+	cipher    core.Cipher
+	muxClient *mux.Client
+}
+
+func NewShadowsocks(option ShadowsocksOption) (ctx.Proxy, error) {
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+	cipher, err := core.PickCipher(option.Cipher, nil, option.Password)
+	if err != nil {
+		return nil, fmt.Errorf("ss %s initialize error: %w", addr, err)
+	}
+
+	p := &Shadowsocks{
+		base: &base{
+			name:      option.Name,
+			proxyType: ctx.Shadowsocks,
+			udp:       true,
+		},
+		addr:   addr,
+		mux:    option.Mux,
+		cipher: cipher,
+	}
+	p.muxClient = mux.NewClient(mux.Option{}, func() (net.Conn, error) {
+		return p.streamConn(context.Background(), socks5.ParseAddr("sp.mux.sing-box.arpa:444"))
+	})
+
+	return p, nil
+}
+
+func (p *Shadowsocks) streamConn(ctx context.Context, target socks5.Addr) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", p.addr, err)
+	}
+
+	conn = p.cipher.StreamConn(conn)
+	_, err = conn.Write(target)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *Shadowsocks) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	if p.mux {
+		return p.muxClient.DialContext(ctx, metadata)
+	}
+	return p.streamConn(ctx, socks5.ParseAddr(metadata.RemoteAddress()))
+}
+
+func (p *Shadowsocks) Close() error {
+	return p.muxClient.Close()
+}
+
+func (p *Shadowsocks) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	if p.mux {
+		conn, err := p.muxClient.DialContext(ctx, metadata)
+		if err != nil {
+			return nil, err
+		}
+		return newPacketConn(bufio.NewPacketStreamConn(conn), metadata), nil
+	}
+
+	rAddr, err := net.ResolveUDPAddr("udp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenPacket("udp", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssPacketConn{
+		PacketConn: p.cipher.PacketConn(pc),
+		rAddr:      rAddr,
+		target:     socks5.ParseAddr(metadata.RemoteAddress()),
+	}, nil
+}
+
+// ssPacketConn send packet to the target with shadowsocks udp relay, every packet is [target address][payload].
+type ssPacketConn struct {
+	net.PacketConn
+	rAddr  net.Addr
+	target socks5.Addr
+}
+
+func (c *ssPacketConn) WriteTo(b []byte, _ net.Addr) (n int, err error) {
+	buf := pool.Get(len(c.target) + len(b))
+	defer pool.Put(buf)
+	copy(buf, c.target)
+	copy(buf[len(c.target):], b)
+	_, err = c.PacketConn.WriteTo(buf, c.rAddr)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *ssPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, _, err := c.PacketConn.ReadFrom(b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	addr := socks5.SplitAddr(b[:n])
+	if addr == nil {
+		return 0, nil, fmt.Errorf("parse addr error")
+	}
+
+	var from net.Addr
+	if udpAddr := addr.UDPAddr(); udpAddr != nil {
+		from = udpAddr
+	}
+	copy(b, b[len(addr):n])
+	return n - len(addr), from, nil
+}
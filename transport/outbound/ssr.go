@@ -0,0 +1,155 @@
+package outbound
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/shadowsocks/core"
+	"github.com/tiechui1994/tcpover/transport/shadowsocks/shadowaead"
+	"github.com/tiechui1994/tcpover/transport/shadowsocks/shadowstream"
+	"github.com/tiechui1994/tcpover/transport/socks5"
+	"github.com/tiechui1994/tcpover/transport/ssr/obfs"
+	"github.com/tiechui1994/tcpover/transport/ssr/protocol"
+)
+
+type ShadowsocksROption struct {
+	Name          string `proxy:"name"`
+	Server        string `proxy:"server"`
+	Port          int    `proxy:"port"`
+	Password      string `proxy:"password"`
+	Cipher        string `proxy:"cipher"`
+	Obfs          string `proxy:"obfs"`
+	ObfsParam     string `proxy:"obfs-param,omitempty"`
+	Protocol      string `proxy:"protocol"`
+	ProtocolParam string `proxy:"protocol-param,omitempty"`
+}
+
+type ShadowsocksR struct {
+	*base
+	addr     string
+	cipher   core.Cipher
+	obfs     obfs.Obfs
+	protocol protocol.Protocol
+}
+
+func NewShadowsocksR(option ShadowsocksROption) (ctx.Proxy, error) {
+	// SSR protocol compatibility, none cipher equals to dummy
+	if option.Cipher == "none" {
+		option.Cipher = "dummy"
+	}
+
+	addr := net.JoinHostPort(option.Server, strconv.Itoa(option.Port))
+	cipher, err := core.PickCipher(option.Cipher, nil, option.Password)
+	if err != nil {
+		return nil, fmt.Errorf("ssr %s initialize error: %w", addr, err)
+	}
+
+	var (
+		ivSize int
+		key    []byte
+	)
+	if option.Cipher == "dummy" {
+		ivSize = 0
+		key = core.Kdf(option.Password, 16)
+	} else {
+		streamCipher, ok := cipher.(*core.StreamCipher)
+		if !ok {
+			return nil, fmt.Errorf("%s is not none or a supported stream cipher in ssr", option.Cipher)
+		}
+		ivSize = streamCipher.IVSize()
+		key = streamCipher.Key
+	}
+
+	obfsConn, obfsOverhead, err := obfs.PickObfs(option.Obfs, &obfs.Base{
+		Host:   option.Server,
+		Port:   option.Port,
+		Key:    key,
+		IVSize: ivSize,
+		Param:  option.ObfsParam,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssr %s initialize obfs error: %w", addr, err)
+	}
+
+	protocolConn, err := protocol.PickProtocol(option.Protocol, &protocol.Base{
+		Key:      key,
+		Overhead: obfsOverhead,
+		Param:    option.ProtocolParam,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ssr %s initialize protocol error: %w", addr, err)
+	}
+
+	return &ShadowsocksR{
+		base: &base{
+			name:      option.Name,
+			proxyType: ctx.SSR,
+			udp:       true,
+		},
+		addr:     addr,
+		cipher:   cipher,
+		obfs:     obfsConn,
+		protocol: protocolConn,
+	}, nil
+}
+
+// streamConn chain obfs, cipher and protocol, the order is important
+func (p *ShadowsocksR) streamConn(c net.Conn, target socks5.Addr) (net.Conn, error) {
+	c = p.obfs.StreamConn(c)
+	c = p.cipher.StreamConn(c)
+
+	var (
+		iv  []byte
+		err error
+	)
+	switch conn := c.(type) {
+	case *shadowstream.Conn:
+		iv, err = conn.ObtainWriteIV()
+		if err != nil {
+			return nil, err
+		}
+	case *shadowaead.Conn:
+		return nil, fmt.Errorf("invalid connection type")
+	}
+
+	c = p.protocol.StreamConn(c, iv)
+	_, err = c.Write(target)
+	return c, err
+}
+
+func (p *ShadowsocksR) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s connect error: %w", p.addr, err)
+	}
+
+	c, err := p.streamConn(conn, socks5.ParseAddr(metadata.RemoteAddress()))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (p *ShadowsocksR) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	rAddr, err := net.ResolveUDPAddr("udp", p.addr)
+	if err != nil {
+		return nil, err
+	}
+	pc, err := net.ListenPacket("udp", "")
+	if err != nil {
+		return nil, err
+	}
+
+	pc = p.cipher.PacketConn(pc)
+	pc = p.protocol.PacketConn(pc)
+	return &ssPacketConn{
+		PacketConn: pc,
+		rAddr:      rAddr,
+		target:     socks5.ParseAddr(metadata.RemoteAddress()),
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/common/bufio"
 	"github.com/tiechui1994/tcpover/transport/mux"
 	"github.com/tiechui1994/tcpover/transport/socks5"
 	"github.com/tiechui1994/tcpover/transport/vless"
@@ -18,6 +19,8 @@ import (
 type VlessOption struct {
 	WlessOption
 	UUID string `proxy:"uuid"`
+	// Users is the accounts(name => uuid) accepted by passive responder, empty accept any uuid
+	Users map[string]string `proxy:"users,omitempty"`
 }
 
 func NewVless(option VlessOption) (ctx.Proxy, error) {
@@ -33,29 +36,63 @@ func NewVless(option VlessOption) (ctx.Proxy, error) {
 		return nil, err
 	}
 
+	var responder *PassiveResponder
 	if option.Direct == DirectRecvOnly || option.Direct == DirectSendRecv {
-		responder := PassiveResponder{server: option.Server}
-		responder.manage(option.Local, option.Header)
+		users, err := newVlessUsers(option.Users)
+		if err == nil {
+			responder, err = newPassiveResponder(option.WlessOption, users)
+		}
+		if err != nil {
+			_ = dispatcher.Close()
+			return nil, err
+		}
+		go responder.manage(option.Local, option.Header)
 	}
 
 	return &Vless{
 		base: &base{
 			name:      option.Name,
 			proxyType: ctx.Vless,
+			udp:       true,
 		},
 		dispatcher: dispatcher,
+		responder:  responder,
 	}, nil
 }
 
+func newVlessUsers(accounts map[string]string) (*vless.Users, error) {
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	return vless.NewUsers(accounts)
+}
+
 type Vless struct {
 	*base
 	dispatcher dispatcher
+	responder  *PassiveResponder
+}
+
+// Close close the mux sessions and stop the passive responder
+func (p *Vless) Close() error {
+	if p.responder != nil {
+		p.responder.Close()
+	}
+	return p.dispatcher.Close()
 }
 
 func (p *Vless) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
 	return p.dispatcher.DialContext(ctx, metadata)
 }
 
+func (p *Vless) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	conn, err := p.dispatcher.DialContext(ctx, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(bufio.NewPacketStreamConn(conn), metadata), nil
+}
+
 func handleOption(option *WlessOption) {
 	if option.Mode.IsDirect() {
 		if option.Mux {
@@ -81,12 +118,19 @@ func handleOption(option *WlessOption) {
 
 func newWlessDirectConnDispatcher(option WlessOption) (*directConnDispatcher, error) {
 	client := wless.NewClient()
+	if option.Version >= int(wless.Version2) {
+		client.Version = wless.Version2
+	}
 
 	handleOption(&option)
 	log.Debugln("mux: %v, %v", option.Mux, option.Mode)
 
-	muxClient := mux.NewClient(func() (net.Conn, error) {
-		conn, err := connect(context.Background(), option.Mode, option.Server, option.Remote, ctx.Wless, option.Header)
+	muxOption, err := option.muxOption()
+	if err != nil {
+		return nil, err
+	}
+	muxClient := mux.NewClient(muxOption, func() (net.Conn, error) {
+		conn, err := connect(context.Background(), option.Mode, option.Server, option.Remote, "", ctx.Wless, option.Header, option.auth())
 		if err != nil {
 			return nil, err
 		}
@@ -96,12 +140,13 @@ func newWlessDirectConnDispatcher(option WlessOption) (*directConnDispatcher, er
 	})
 
 	return &directConnDispatcher{
+		muxClient: muxClient,
 		createConn: func(cx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
 			if option.Mux {
 				return muxClient.DialContext(cx, metadata)
 			}
 
-			conn, err := connect(cx, option.Mode, option.Server, option.Remote, ctx.Wless, option.Header)
+			conn, err := connect(cx, option.Mode, option.Server, option.Remote, metadata.NetWork, ctx.Wless, option.Header, option.auth())
 			if err != nil {
 				return nil, err
 			}
@@ -119,8 +164,12 @@ func newVlessDirectConnDispatcher(option VlessOption) (*directConnDispatcher, er
 		return nil, err
 	}
 
-	muxClient := mux.NewClient(func() (net.Conn, error) {
-		conn, err := connect(context.Background(), option.Mode, option.Server, option.Remote, ctx.Vless, option.Header)
+	muxOption, err := option.muxOption()
+	if err != nil {
+		return nil, err
+	}
+	muxClient := mux.NewClient(muxOption, func() (net.Conn, error) {
+		conn, err := connect(context.Background(), option.Mode, option.Server, option.Remote, "", ctx.Vless, option.Header, option.auth())
 		if err != nil {
 			return nil, err
 		}
@@ -135,12 +184,13 @@ func newVlessDirectConnDispatcher(option VlessOption) (*directConnDispatcher, er
 	})
 
 	return &directConnDispatcher{
+		muxClient: muxClient,
 		createConn: func(cx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
 			if option.Mux {
 				return muxClient.DialContext(cx, metadata)
 			}
 
-			conn, err := connect(cx, option.Mode, option.Server, option.Remote, ctx.Vless, option.Header)
+			conn, err := connect(cx, option.Mode, option.Server, option.Remote, metadata.NetWork, ctx.Vless, option.Header, option.auth())
 			if err != nil {
 				return nil, err
 			}
@@ -151,17 +201,24 @@ func newVlessDirectConnDispatcher(option VlessOption) (*directConnDispatcher, er
 }
 
 type directConnDispatcher struct {
+	muxClient  *mux.Client
 	createConn func(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error)
 }
 
-func connect(ctx context.Context, optionMode wss.Mode, optionServer, remoteName string, proxyType ctx.ProxyType, header map[string]string) (net.Conn, error) {
+func (c *directConnDispatcher) Close() error {
+	return c.muxClient.Close()
+}
+
+func connect(ctx context.Context, optionMode wss.Mode, optionServer, remoteName, network string, proxyType ctx.ProxyType, header map[string]string, auth *wss.Auth) (net.Conn, error) {
 	// name: 直接连接, name is empty
 	//       远程代理, name not empty
 	// mode: ModeDirect | ModeForward
 	conn, err := wss.WebSocketConnect(ctx, optionServer, &wss.ConnectParam{
-		Name:   remoteName,
-		Mode:   optionMode,
-		Header: wss.Header(proxyType, header),
+		Name:    remoteName,
+		Mode:    optionMode,
+		Network: network,
+		Header:  wss.Header(proxyType, header),
+		Auth:    auth,
 	})
 	if err != nil {
 		return nil, err
@@ -196,7 +253,7 @@ func parseVlessAddr(metadata *ctx.Metadata) *vless.DstAddr {
 
 	port := metadata.DstPort
 	return &vless.DstAddr{
-		UDP:      false,
+		UDP:      metadata.NetWork == "udp",
 		AddrType: addrType,
 		Addr:     addr,
 		Port:     uint(port),
@@ -7,14 +7,22 @@ import (
 	"io"
 	"net"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
 	"github.com/tiechui1994/tcpover/transport/common/bufio"
+	"github.com/tiechui1994/tcpover/transport/control"
 	"github.com/tiechui1994/tcpover/transport/inbound"
 	"github.com/tiechui1994/tcpover/transport/mux"
 	"github.com/tiechui1994/tcpover/transport/socks5"
+	"github.com/tiechui1994/tcpover/transport/statistic"
 	"github.com/tiechui1994/tcpover/transport/vless"
 	"github.com/tiechui1994/tcpover/transport/wless"
 	"github.com/tiechui1994/tcpover/transport/wss"
@@ -27,15 +35,69 @@ const (
 	DirectSendRecv = "sendrecv"
 )
 
+const (
+	// manageTimeout is the max silence of server on control channel, it is reconnected when nothing is received
+	manageTimeout      = 30 * time.Second
+	manageWriteTimeout = 10 * time.Second
+)
+
 type WlessOption struct {
 	Name   string            `proxy:"name"`
-	Local  string            `proxy:"local"`
-	Remote string            `proxy:"remote"`
-	Mode   wss.Mode          `proxy:"mode"`
+	Local  string            `proxy:"local,omitempty"`
+	Remote string            `proxy:"remote,omitempty"`
+	Mode   wss.Mode          `proxy:"mode,omitempty"`
 	Server string            `proxy:"server"`
-	Direct string            `proxy:"direct"`
-	Mux    bool              `proxy:"mux"`
-	Header map[string]string `proxy:"header"`
+	Direct string            `proxy:"direct,omitempty"`
+	Mux    bool              `proxy:"mux,omitempty"`
+	Header map[string]string `proxy:"header,omitempty"`
+	// MuxProtocol is one of smux(default), yamux and h2mux
+	MuxProtocol string `proxy:"mux-protocol,omitempty"`
+	// session pool of mux, see mux.Option. MuxIdleTimeout is seconds
+	MuxMaxConnections int  `proxy:"mux-max-connections,omitempty"`
+	MuxMinStreams     int  `proxy:"mux-min-streams,omitempty"`
+	MuxMaxStreams     int  `proxy:"mux-max-streams,omitempty"`
+	MuxIdleTimeout    int  `proxy:"mux-idle-timeout,omitempty"`
+	MuxPadding        bool `proxy:"mux-padding,omitempty"`
+	// Version of wless handshake, 2 reports dial error of server, default 1
+	Version int    `proxy:"version,omitempty"`
+	User    string `proxy:"user,omitempty"`
+	Token   string `proxy:"token,omitempty"`
+	Secret  string `proxy:"secret,omitempty"`
+	// Allow and Deny is the acl of target accepted by passive responder, see rules.NewACL
+	Allow []string `proxy:"allow,omitempty"`
+	Deny  []string `proxy:"deny,omitempty"`
+	// Services is the published services(name => addr) of passive responder, they are not checked by acl
+	Services map[string]string `proxy:"services,omitempty"`
+	// Reverse ask server to listen and relay the accepted connection to target, format: [connector/]listen=target.
+	// It listens on the connector agent when connector is set, otherwise on server.
+	Reverse []string `proxy:"reverse,omitempty"`
+	// AcceptReverse allow server to open the reverse forward listener of other agents on local
+	AcceptReverse bool `proxy:"accept-reverse,omitempty"`
+}
+
+func (o *WlessOption) auth() *wss.Auth {
+	if o.User == "" {
+		return nil
+	}
+	return &wss.Auth{User: o.User, Token: o.Token, Secret: o.Secret}
+}
+
+func (o *WlessOption) muxOption() (mux.Option, error) {
+	protocol, err := mux.ParseProtocol(o.MuxProtocol)
+	if err != nil {
+		return mux.Option{}, err
+	}
+	if o.MuxMaxConnections > 0 && o.MuxMaxStreams > 0 {
+		return mux.Option{}, fmt.Errorf("mux-max-connections conflicts with mux-max-streams")
+	}
+	return mux.Option{
+		Protocol:       protocol,
+		MaxConnections: o.MuxMaxConnections,
+		MinStreams:     o.MuxMinStreams,
+		MaxStreams:     o.MuxMaxStreams,
+		IdleTimeout:    time.Duration(o.MuxIdleTimeout) * time.Second,
+		Padding:        o.MuxPadding,
+	}, nil
 }
 
 func NewWless(option WlessOption) (ctx.Proxy, error) {
@@ -51,52 +113,213 @@ func NewWless(option WlessOption) (ctx.Proxy, error) {
 		return nil, err
 	}
 
+	var responder *PassiveResponder
 	if option.Direct == DirectRecvOnly || option.Direct == DirectSendRecv {
-		responder := &PassiveResponder{server: option.Server}
-		responder.manage(option.Local, option.Header)
+		responder, err = newPassiveResponder(option, nil)
+		if err != nil {
+			_ = dispatcher.Close()
+			return nil, err
+		}
+		go responder.manage(option.Local, option.Header)
 	}
 
 	return &Wless{
 		base: &base{
 			name:      option.Name,
 			proxyType: ctx.Wless,
+			udp:       true,
 		},
 		dispatcher: dispatcher,
+		responder:  responder,
 	}, nil
 }
 
 type dispatcher interface {
 	DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error)
+	Close() error
 }
 
 type Wless struct {
 	*base
 	dispatcher dispatcher
+	responder  *PassiveResponder
+}
+
+// Close close the mux sessions and stop the passive responder
+func (p *Wless) Close() error {
+	if p.responder != nil {
+		p.responder.Close()
+	}
+	return p.dispatcher.Close()
 }
 
 func (p *Wless) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
 	return p.dispatcher.DialContext(ctx, metadata)
 }
 
-type ControlMessage struct {
-	Command uint32
-	Data    map[string]interface{}
+func (p *Wless) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	conn, err := p.dispatcher.DialContext(ctx, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return newPacketConn(bufio.NewPacketStreamConn(conn), metadata), nil
 }
 
-const (
-	CommandLink = 0x01
-	CommandPing = 0x02
-)
-
 type PassiveResponder struct {
-	count  int32
-	server string
+	count      int32 // number of active links
+	server     string
+	auth       *wss.Auth
+	vlessUsers *vless.Users
+
+	writeMux sync.Mutex // lock of control channel write
+	draining int32
+	maxLinks int32
+	rejected int32 // times of registration rejected by server continuously
+
+	acl       *rules.ACL   // local acl
+	remoteACL atomic.Value // *rules.ACL pushed by server
+	services  map[string]string
+	reverse   []control.Listen
+	listen    bool // accept Listen as connector
+
+	connMux   sync.Mutex
+	conn      *websocket.Conn // current control channel
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPassiveResponder(option WlessOption, users *vless.Users) (*PassiveResponder, error) {
+	acl, err := rules.NewACL(option.Allow, option.Deny)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]string, len(option.Services)+len(option.Reverse))
+	for name, addr := range option.Services {
+		services[name] = addr
+	}
+	reverse := make([]control.Listen, 0, len(option.Reverse))
+	for _, line := range option.Reverse {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid reverse %q, format: [connector/]listen=target", line)
+		}
+		listen := control.Listen{Addr: kv[0]}
+		if i := strings.Index(kv[0], "/"); i >= 0 {
+			listen.On, listen.Addr = kv[0][:i], kv[0][i+1:]
+		}
+		// the target is published as service, which is linked by the reverse listener
+		listen.Service = "reverse:" + kv[0]
+		services[listen.Service] = kv[1]
+		reverse = append(reverse, listen)
+	}
+
+	return &PassiveResponder{
+		server:     option.Server,
+		auth:       option.auth(),
+		vlessUsers: users,
+		acl:        acl,
+		services:   services,
+		reverse:    reverse,
+		listen:     option.AcceptReverse,
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+// Close close the control channel and stop reconnecting, the active links are not closed
+func (c *PassiveResponder) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+func (c *PassiveResponder) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConn record the control channel, return false if responder is closed
+func (c *PassiveResponder) setConn(conn *websocket.Conn) bool {
+	c.connMux.Lock()
+	defer c.connMux.Unlock()
+	if c.isClosed() {
+		return false
+	}
+	c.conn = conn
+	return true
+}
+
+// check the target is allowed by both local acl and the acl pushed by server
+func (c *PassiveResponder) check(metadata *ctx.Metadata) error {
+	if err := c.acl.Check(metadata); err != nil {
+		return err
+	}
+	acl, _ := c.remoteACL.Load().(*rules.ACL)
+	return acl.Check(metadata)
+}
+
+// send write message to control channel, it is safe to call concurrently
+func (c *PassiveResponder) send(conn *websocket.Conn, command uint32, data interface{}) error {
+	msg, err := control.NewMessage(command, data)
+	if err != nil {
+		return err
+	}
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	_ = conn.SetWriteDeadline(time.Now().Add(manageWriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// decline return the reason of refusing link, empty means accept
+func (c *PassiveResponder) decline(link *control.Link) string {
+	if atomic.LoadInt32(&c.draining) == 1 {
+		return "agent is draining"
+	}
+	if link.Service != "" {
+		if _, ok := c.services[link.Service]; !ok {
+			return fmt.Sprintf("unknown service %v", link.Service)
+		}
+	} else if link.Proto != ctx.Wless && link.Proto != ctx.Vless {
+		return fmt.Sprintf("unsupported proto %v", link.Proto)
+	}
+	if max := atomic.LoadInt32(&c.maxLinks); max > 0 && atomic.LoadInt32(&c.count) >= max {
+		return fmt.Sprintf("too many links, max %v", max)
+	}
+	return ""
+}
+
+// linkDone close the control channel when the last link of draining agent is done
+func (c *PassiveResponder) linkDone(conn *websocket.Conn) {
+	if atomic.AddInt32(&c.count, -1) == 0 && atomic.LoadInt32(&c.draining) == 1 {
+		closeDrained(conn)
+	}
+}
+
+func closeDrained(conn *websocket.Conn) {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "drained")
+	_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
 }
 
 func (c *PassiveResponder) manage(name string, header map[string]string) {
 	times := 1
+	if rejected := atomic.LoadInt32(&c.rejected); rejected > 0 {
+		times = 1 << rejected
+	}
 try:
-	time.Sleep(time.Second * time.Duration(times))
+	select {
+	case <-time.After(time.Second * time.Duration(times)):
+	case <-c.closed:
+		return
+	}
 	if times >= 64 {
 		times = 1
 	}
@@ -104,33 +327,105 @@ try:
 		Name:   name,
 		Role:   wss.RoleManager,
 		Header: wss.Header("", header),
+		Auth:   c.auth,
 	})
 	if err != nil {
 		log.Errorln("Manage::DialContext: %v", err)
 		times = times * 2
 		goto try
 	}
+	if !c.setConn(conn) {
+		_ = conn.Close()
+		return
+	}
 
 	var onceClose sync.Once
 	closeFunc := func() {
 		log.Errorln("Manage Socket Close: %v", conn.Close())
+		if atomic.LoadInt32(&c.draining) == 1 {
+			log.Infoln("Manage [%v] drained", name)
+			return
+		}
+		if c.isClosed() {
+			log.Infoln("Manage [%v] closed", name)
+			return
+		}
 		c.manage(name, header)
 		log.Errorln("Reconnect to server success")
 	}
 
+	services := make([]string, 0, len(c.services))
+	for service := range c.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	err = c.send(conn, control.CommandHello, control.Hello{
+		Version:  control.Version,
+		Protos:   []string{ctx.Wless, ctx.Vless},
+		Mux:      true,
+		Services: services,
+		Listen:   c.listen,
+	})
+	if err != nil {
+		log.Errorln("Manage hello: %v", err)
+	}
+	for _, listen := range c.reverse {
+		if err := c.send(conn, control.CommandListen, listen); err != nil {
+			log.Errorln("Manage reverse listen: %v", err)
+		}
+	}
+
+	// listeners of reverse forward opened as connector, closed with the control channel. agent/addr <=> listener
+	listeners := map[string]net.Listener{}
+
+	// server ping every 10s, the control channel is dead when nothing is received in manageTimeout
+	refreshDeadline := func() error {
+		return conn.SetReadDeadline(time.Now().Add(manageTimeout))
+	}
+	conn.SetPingHandler(func(data string) error {
+		_ = refreshDeadline()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(manageWriteTimeout))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
 	go func() {
 		defer onceClose.Do(closeFunc)
+		defer func() {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+		}()
 
 		for {
-			var cmd ControlMessage
+			var cmd control.Message
+			if err := refreshDeadline(); err != nil {
+				return
+			}
 			_, p, err := conn.ReadMessage()
-			if wss.IsClose(err) {
+			if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				log.Errorln("Manage [%v] closed by server: %v", name, err)
+				onceClose.Do(func() {
+					_ = conn.Close()
+				})
+				return
+			}
+			if websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+				if rejected := atomic.LoadInt32(&c.rejected); rejected < 6 {
+					atomic.StoreInt32(&c.rejected, rejected+1)
+				}
+				log.Errorln("Manage [%v] rejected by server, try again later: %v", name, err)
 				return
 			}
 			if err != nil {
-				log.Errorln("ReadMessage: %+v", err)
-				continue
+				if !wss.IsClose(err) {
+					log.Errorln("ReadMessage: %+v", err)
+				}
+				return
 			}
+			atomic.StoreInt32(&c.rejected, 0)
 			err = json.Unmarshal(p, &cmd)
 			if err != nil {
 				log.Errorln("Decode: %v", err)
@@ -138,66 +433,259 @@ try:
 			}
 
 			switch cmd.Command {
-			case CommandLink:
-				log.Debugln("ControlMessage => cmd %v, data: %v", cmd.Command, cmd.Data)
+			case control.CommandLink:
+				log.Debugln("ControlMessage => cmd %v, data: %s", cmd.Command, cmd.Data)
+				var link control.Link
+				if err := cmd.Decode(&link); err != nil {
+					log.Errorln("%v", err)
+					continue
+				}
+				if reason := c.decline(&link); reason != "" {
+					log.Errorln("Decline link [%v]: %v", link.Code, reason)
+					_ = c.send(conn, control.CommandLinkAck, control.LinkAck{Code: link.Code, Reason: reason})
+					continue
+				}
+				_ = c.send(conn, control.CommandLinkAck, control.LinkAck{Code: link.Code, Accept: true})
+
+				atomic.AddInt32(&c.count, 1)
 				go func() {
-					code := cmd.Data["Code"].(string)
-					network := cmd.Data["Network"].(string)
-					proto := cmd.Data["Proto"].(string)
-					isMux, _ := cmd.Data["Mux"].(bool)
-					err = c.connectLocal(code, network, proto, header, isMux)
+					defer c.linkDone(conn)
+					err := c.connectLocal(&link, header)
 					if err != nil {
 						log.Errorln("ConnectLocal: %v", err)
 					}
 				}()
+			case control.CommandPing:
+				var ping control.Ping
+				_ = cmd.Decode(&ping)
+				_ = c.send(conn, control.CommandPong, ping)
+			case control.CommandConfig:
+				var config control.Config
+				if err := cmd.Decode(&config); err != nil {
+					log.Errorln("%v", err)
+					continue
+				}
+				log.Infoln("Manage [%v] config: %+v", name, config)
+				atomic.StoreInt32(&c.maxLinks, int32(config.MaxLinks))
+				acl, err := rules.NewACL(config.Allow, config.Deny)
+				if err != nil {
+					log.Errorln("Manage [%v] acl: %v", name, err)
+					continue
+				}
+				c.remoteACL.Store(acl)
+			case control.CommandListen:
+				var listen control.Listen
+				if err := cmd.Decode(&listen); err != nil {
+					log.Errorln("%v", err)
+					continue
+				}
+				ack := control.ListenAck{Addr: listen.Addr, Agent: listen.Agent}
+				// the agent send Listen again when it reconnects, the opened listener is kept
+				key := listen.Agent + "/" + listen.Addr
+				if _, ok := listeners[key]; !ok {
+					l, err := c.reverseListen(listen)
+					if err != nil {
+						log.Errorln("Manage [%v] reverse listen %v: %v", name, listen.Addr, err)
+						ack.Error = err.Error()
+					} else {
+						listeners[key] = l
+					}
+				}
+				_ = c.send(conn, control.CommandListenAck, ack)
+			case control.CommandListenAck:
+				var ack control.ListenAck
+				if err := cmd.Decode(&ack); err != nil {
+					log.Errorln("%v", err)
+					continue
+				}
+				on := ack.On
+				if on == "" {
+					on = "server"
+				}
+				if ack.Error != "" {
+					log.Errorln("Manage [%v] reverse listen %v on %v: %v", name, ack.Addr, on, ack.Error)
+					c.retryListen(conn, ack)
+				} else {
+					log.Infoln("Manage [%v] reverse listen %v on %v", name, ack.Addr, on)
+				}
+			case control.CommandDrain:
+				var drain control.Drain
+				_ = cmd.Decode(&drain)
+				log.Infoln("Manage [%v] draining: %v", name, drain.Reason)
+				atomic.StoreInt32(&c.draining, 1)
+				_ = c.send(conn, control.CommandDrain, drain)
+				if atomic.LoadInt32(&c.count) == 0 {
+					closeDrained(conn)
+				}
 			}
 		}
 	}()
 }
 
-func (c *PassiveResponder) connectLocal(code, network, proto string, header map[string]string, isMux bool) error {
+func (c *PassiveResponder) connectLocal(link *control.Link, header map[string]string) error {
 	var mode = wss.ModeForward
-	if isMux {
+	if link.Mux {
 		mode = wss.ModeForwardMux
 	}
+	network, proto := link.Network, link.Proto
 	conn, err := wss.WebSocketConnect(context.Background(), c.server, &wss.ConnectParam{
-		Code:   code,
+		Code:   link.Code,
 		Mode:   mode,
 		Header: wss.Header(proto, header),
+		Auth:   c.auth,
 	})
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	if link.Service != "" {
+		return c.connectService(conn, link.Service)
+	}
+
 	var addr socks5.Addr
+	var user string
+	var handshaker ctx.Handshaker
 	switch proto {
 	case ctx.Vless:
-		addr, err = vless.ReadAddr(conn)
+		var request *vless.Request
+		request, err = vless.ReadRequest(conn, c.vlessUsers)
+		if err == nil {
+			addr, user = request.Addr, request.User
+		}
 	default:
-		addr, err = wless.ReadAddr(conn)
+		var request *wless.Request
+		request, err = wless.ReadRequest(conn)
+		if err == nil {
+			addr = request.Addr
+			handshaker, _ = wless.NewServerConn(conn, request.Version).(ctx.Handshaker)
+		}
 	}
 	if err != nil {
 		return err
 	}
 
 	cc := inbound.NewSocket(addr, conn, ctx.SHADOWSOCKS)
+	cc.Metadata().User = user
+	cc.Metadata().NetWork = network
+	log.Debugln("connect local addr: %v, user: %v", cc.Metadata().RemoteAddress(), user)
 	if mux.IsSpecialFqdn(cc.Metadata().Host) {
-		server := mux.NewServer()
-		err = server.NewConnection(conn)
+		if handshaker != nil {
+			_ = handshaker.HandshakeSuccess()
+		}
+		server := mux.NewServer(c.check)
+		err = server.NewConnection(conn, cc.Metadata())
 		if err != nil && err != io.EOF {
 			log.Errorln("NewConnection: %v", err)
 		}
 	} else {
 		// link
-		remote := conn
-		local, err := net.Dial(network, cc.Metadata().RemoteAddress())
+		var remote = conn
+		if network == "udp" {
+			remote = bufio.NewPacketStreamConn(conn)
+		}
+		var local net.Conn
+		err := c.check(cc.Metadata())
+		if err == nil {
+			local, err = net.Dial(network, cc.Metadata().DialAddress())
+		}
+		if handshaker != nil {
+			if err != nil {
+				_ = handshaker.HandshakeFailure(err)
+			} else {
+				_ = handshaker.HandshakeSuccess()
+			}
+		}
 		if err != nil {
 			return err
 		}
 
+		info := statistic.NewTrackerInfo(cc.Metadata(), nil, nil)
+		info.Chain = []string{"agent"}
+		local = statistic.NewTCPTracker(local, statistic.DefaultManager, info)
 		bufio.Relay(local, remote, nil)
 	}
 
 	return nil
 }
+
+// retryListen resend Listen of connector later, the connector may be not registered yet
+func (c *PassiveResponder) retryListen(conn *websocket.Conn, ack control.ListenAck) {
+	if ack.On == "" {
+		return
+	}
+	for _, listen := range c.reverse {
+		if listen.On == ack.On && listen.Addr == ack.Addr {
+			listen := listen
+			time.AfterFunc(10*time.Second, func() {
+				_ = c.send(conn, control.CommandListen, listen)
+			})
+			return
+		}
+	}
+}
+
+// reverseListen open the reverse forward listener as connector, the accepted connection is
+// relayed to the service of agent.
+func (c *PassiveResponder) reverseListen(listen control.Listen) (net.Listener, error) {
+	if !c.listen {
+		return nil, fmt.Errorf("reverse listen is not accepted")
+	}
+	l, err := net.Listen("tcp", listen.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infoln("reverse listen on %v => agent [%v] service [%v]", l.Addr(), listen.Agent, listen.Service)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				remote, err := wss.WebSocketConnect(context.Background(), c.server, &wss.ConnectParam{
+					Name:    listen.Agent,
+					Mode:    wss.ModeForward,
+					Service: listen.Service,
+					Auth:    c.auth,
+				})
+				if err != nil {
+					log.Errorln("reverse [%v] of agent [%v] connect: %v", listen.Addr, listen.Agent, err)
+					return
+				}
+				defer remote.Close()
+				bufio.Relay(conn, remote, nil)
+			}()
+		}
+	}()
+	return l, nil
+}
+
+// connectService relay the raw data of conn to published service
+func (c *PassiveResponder) connectService(conn net.Conn, service string) error {
+	addr := c.services[service]
+	log.Debugln("connect service [%v] addr: %v", service, addr)
+	local, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("service [%v] connect %v: %w", service, addr, err)
+	}
+
+	metadata := &ctx.Metadata{NetWork: "tcp", Type: ctx.SHADOWSOCKS, Origin: service}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			metadata.DstIP = ip
+		} else {
+			metadata.Host = host
+		}
+		if p, err := strconv.ParseUint(port, 10, 16); err == nil {
+			metadata.DstPort = uint16(p)
+		}
+	}
+	info := statistic.NewTrackerInfo(metadata, nil, nil)
+	info.Chain = []string{"agent", service}
+	local = statistic.NewTCPTracker(local, statistic.DefaultManager, info)
+	bufio.Relay(local, conn, nil)
+	return nil
+}
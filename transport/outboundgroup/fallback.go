@@ -0,0 +1,49 @@
+package outboundgroup
+
+import (
+	"context"
+	"net"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+// Fallback select the first alive proxy, the first proxy is used when all are dead.
+type Fallback struct {
+	*groupBase
+}
+
+func NewFallback(option *GroupCommonOption, proxies []ctx.Proxy) *Fallback {
+	return &Fallback{
+		groupBase: &groupBase{
+			name:      option.Name,
+			proxyType: ctx.Fallback,
+			proxies:   proxies,
+			health:    NewHealthCheck(proxies, option.URL, option.interval()),
+		},
+	}
+}
+
+func (f *Fallback) Now() string {
+	return f.findAliveProxy().Name()
+}
+
+func (f *Fallback) findAliveProxy() ctx.Proxy {
+	for _, proxy := range f.proxies {
+		if f.health.Alive(proxy.Name()) {
+			return proxy
+		}
+	}
+	return f.proxies[0]
+}
+
+func (f *Fallback) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	return f.findAliveProxy().DialContext(ctx, metadata)
+}
+
+func (f *Fallback) SupportUDP() bool {
+	return f.findAliveProxy().SupportUDP()
+}
+
+func (f *Fallback) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	return f.findAliveProxy().ListenPacketContext(ctx, metadata)
+}
@@ -0,0 +1,111 @@
+package outboundgroup
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+// Group is the proxy which select one of the wrapped proxies
+type Group = ctx.ProxyGroup
+
+type groupBase struct {
+	name      string
+	proxyType ctx.ProxyType
+	proxies   []ctx.Proxy
+	health    *HealthCheck
+}
+
+func (g *groupBase) Name() string {
+	return g.name
+}
+
+func (g *groupBase) Type() ctx.ProxyType {
+	return g.proxyType
+}
+
+func (g *groupBase) Proxies() []ctx.Proxy {
+	return g.proxies
+}
+
+// Close stop the health check of group, the wrapped proxies are not closed
+func (g *groupBase) Close() error {
+	g.health.Close()
+	return nil
+}
+
+// HealthCheck return the health check of group
+func (g *groupBase) HealthCheck() *HealthCheck {
+	return g.health
+}
+
+// URLDelay return the delay(ms) of a HEAD request to url through proxy
+func URLDelay(ct context.Context, proxy ctx.Proxy, target string) (uint16, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return 0, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	portVal, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port of url [%v]", target)
+	}
+
+	metadata := &ctx.Metadata{
+		NetWork: "tcp",
+		Host:    u.Hostname(),
+		DstPort: uint16(portVal),
+	}
+	if ip := net.ParseIP(metadata.Host); ip != nil {
+		metadata.DstIP = ip
+		metadata.Host = ""
+	}
+
+	start := time.Now()
+	conn, err := proxy.DialContext(ct, metadata)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ct.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err = tlsConn.HandshakeContext(ct); err != nil {
+			return 0, err
+		}
+		conn = tlsConn
+	}
+
+	req, err := http.NewRequest(http.MethodHead, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err = req.Write(conn); err != nil {
+		return 0, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+
+	return uint16(time.Since(start) / time.Millisecond), nil
+}
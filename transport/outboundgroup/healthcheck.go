@@ -0,0 +1,114 @@
+package outboundgroup
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tool/log"
+)
+
+const (
+	defaultTestURL  = "http://www.gstatic.com/generate_204"
+	defaultInterval = 300 * time.Second
+	defaultTimeout  = 5 * time.Second
+	unknownDelay    = math.MaxUint16
+)
+
+type proxyState struct {
+	alive bool
+	delay uint16
+	time  time.Time
+}
+
+// HealthCheck test the proxies by url periodically, the proxy never tested is alive.
+type HealthCheck struct {
+	url      string
+	interval time.Duration
+	proxies  []ctx.Proxy
+
+	mux    sync.RWMutex
+	states map[string]*proxyState
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewHealthCheck(proxies []ctx.Proxy, url string, interval time.Duration) *HealthCheck {
+	hc := &HealthCheck{
+		url:      url,
+		interval: interval,
+		proxies:  proxies,
+		states:   map[string]*proxyState{},
+		done:     make(chan struct{}),
+	}
+	if url != "" && interval > 0 {
+		go hc.process()
+	}
+	return hc
+}
+
+func (hc *HealthCheck) process() {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+
+	hc.Check()
+	for {
+		select {
+		case <-ticker.C:
+			hc.Check()
+		case <-hc.done:
+			return
+		}
+	}
+}
+
+// Close stop the periodic test
+func (hc *HealthCheck) Close() {
+	hc.closeOnce.Do(func() {
+		close(hc.done)
+	})
+}
+
+// Check test all proxies concurrently and wait the result
+func (hc *HealthCheck) Check() {
+	wg := sync.WaitGroup{}
+	for _, proxy := range hc.proxies {
+		wg.Add(1)
+		go func(proxy ctx.Proxy) {
+			defer wg.Done()
+			ct, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+			defer cancel()
+
+			delay, err := URLDelay(ct, proxy, hc.url)
+			if err != nil {
+				log.Debugln("health check [%v] %v: %v", proxy.Name(), hc.url, err)
+			}
+			hc.mux.Lock()
+			hc.states[proxy.Name()] = &proxyState{alive: err == nil, delay: delay, time: time.Now()}
+			hc.mux.Unlock()
+		}(proxy)
+	}
+	wg.Wait()
+}
+
+// Alive return false only if the last test of proxy is failure
+func (hc *HealthCheck) Alive(name string) bool {
+	hc.mux.RLock()
+	defer hc.mux.RUnlock()
+	state, ok := hc.states[name]
+	return !ok || state.alive
+}
+
+// Delay return the last delay of proxy, math.MaxUint16 means unknown or dead
+func (hc *HealthCheck) Delay(name string) uint16 {
+	hc.mux.RLock()
+	defer hc.mux.RUnlock()
+	state, ok := hc.states[name]
+	if !ok || !state.alive {
+		return unknownDelay
+	}
+	return state.delay
+}
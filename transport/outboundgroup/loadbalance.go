@@ -0,0 +1,114 @@
+package outboundgroup
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+const (
+	StrategyConsistentHashing = "consistent-hashing"
+	StrategyRoundRobin        = "round-robin"
+
+	maxRetry = 5
+)
+
+// LoadBalance spread connections over alive proxies. consistent-hashing keep the
+// same destination on the same proxy, round-robin use the proxies in turn.
+type LoadBalance struct {
+	*groupBase
+	strategy string
+	index    uint32
+}
+
+func NewLoadBalance(option *GroupCommonOption, proxies []ctx.Proxy) (*LoadBalance, error) {
+	strategy := option.Strategy
+	switch strategy {
+	case "":
+		strategy = StrategyConsistentHashing
+	case StrategyConsistentHashing, StrategyRoundRobin:
+	default:
+		return nil, fmt.Errorf("unsupport load balance strategy: %v", strategy)
+	}
+
+	return &LoadBalance{
+		groupBase: &groupBase{
+			name:      option.Name,
+			proxyType: ctx.LoadBalance,
+			proxies:   proxies,
+			health:    NewHealthCheck(proxies, option.URL, option.interval()),
+		},
+		strategy: strategy,
+	}, nil
+}
+
+// Now return the next proxy of round-robin, it is empty for consistent-hashing
+func (lb *LoadBalance) Now() string {
+	if lb.strategy == StrategyRoundRobin {
+		return lb.proxies[atomic.LoadUint32(&lb.index)%uint32(len(lb.proxies))].Name()
+	}
+	return ""
+}
+
+func (lb *LoadBalance) pick(metadata *ctx.Metadata) ctx.Proxy {
+	if lb.strategy == StrategyRoundRobin {
+		for i := 0; i < len(lb.proxies); i++ {
+			idx := atomic.AddUint32(&lb.index, 1) - 1
+			proxy := lb.proxies[idx%uint32(len(lb.proxies))]
+			if lb.health.Alive(proxy.Name()) {
+				return proxy
+			}
+		}
+		return lb.proxies[0]
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(metadata.String()))
+	key := h.Sum64()
+	buckets := int32(len(lb.proxies))
+	for i := 0; i < maxRetry; i, key = i+1, key+1 {
+		proxy := lb.proxies[jumpHash(key, buckets)]
+		if lb.health.Alive(proxy.Name()) {
+			return proxy
+		}
+	}
+	for _, proxy := range lb.proxies {
+		if lb.health.Alive(proxy.Name()) {
+			return proxy
+		}
+	}
+	return lb.proxies[0]
+}
+
+// jumpHash https://arxiv.org/abs/1406.2294
+func jumpHash(key uint64, buckets int32) int32 {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
+
+func (lb *LoadBalance) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	return lb.pick(metadata).DialContext(ctx, metadata)
+}
+
+// SupportUDP return true if any of proxies support udp, the picked proxy is unknown without metadata
+func (lb *LoadBalance) SupportUDP() bool {
+	for _, proxy := range lb.proxies {
+		if proxy.SupportUDP() {
+			return true
+		}
+	}
+	return false
+}
+
+func (lb *LoadBalance) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	return lb.pick(metadata).ListenPacketContext(ctx, metadata)
+}
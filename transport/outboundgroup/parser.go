@@ -0,0 +1,75 @@
+package outboundgroup
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/common/structure"
+)
+
+const (
+	TypeSelect      = "select"
+	TypeURLTest     = "url-test"
+	TypeFallback    = "fallback"
+	TypeLoadBalance = "load-balance"
+)
+
+type GroupCommonOption struct {
+	Name      string   `group:"name"`
+	Type      string   `group:"type"`
+	Proxies   []string `group:"proxies"`
+	URL       string   `group:"url,omitempty"`
+	Interval  int      `group:"interval,omitempty"`  // second
+	Tolerance int      `group:"tolerance,omitempty"` // ms
+	Strategy  string   `group:"strategy,omitempty"`
+}
+
+func (o *GroupCommonOption) interval() time.Duration {
+	if o.Interval <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(o.Interval) * time.Second
+}
+
+// ParseProxyGroup parse group config, the member proxies are found by lookup
+func ParseProxyGroup(config map[string]interface{}, lookup func(name string) (ctx.Proxy, bool)) (ctx.Proxy, error) {
+	decoder := structure.NewDecoder(structure.Option{TagName: "group", WeaklyTypedInput: true})
+
+	option := &GroupCommonOption{}
+	if err := decoder.Decode(config, option); err != nil {
+		return nil, err
+	}
+	if option.Name == "" {
+		return nil, fmt.Errorf("proxy group name is empty")
+	}
+	if len(option.Proxies) == 0 {
+		return nil, fmt.Errorf("proxy group [%v]: proxies is empty", option.Name)
+	}
+
+	proxies := make([]ctx.Proxy, 0, len(option.Proxies))
+	for _, name := range option.Proxies {
+		proxy, ok := lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("proxy group [%v]: proxy [%v] not found", option.Name, name)
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	if option.Type != TypeSelect && option.URL == "" {
+		option.URL = defaultTestURL
+	}
+
+	switch option.Type {
+	case TypeSelect:
+		return NewSelector(option, proxies), nil
+	case TypeURLTest:
+		return NewURLTest(option, proxies), nil
+	case TypeFallback:
+		return NewFallback(option, proxies), nil
+	case TypeLoadBalance:
+		return NewLoadBalance(option, proxies)
+	default:
+		return nil, fmt.Errorf("proxy group [%v]: unsupport type %v", option.Name, option.Type)
+	}
+}
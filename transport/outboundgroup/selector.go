@@ -0,0 +1,63 @@
+package outboundgroup
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+type Selector struct {
+	*groupBase
+	mux      sync.RWMutex
+	selected ctx.Proxy
+}
+
+func NewSelector(option *GroupCommonOption, proxies []ctx.Proxy) *Selector {
+	return &Selector{
+		groupBase: &groupBase{
+			name:      option.Name,
+			proxyType: ctx.Selector,
+			proxies:   proxies,
+			health:    NewHealthCheck(proxies, option.URL, 0),
+		},
+		selected: proxies[0],
+	}
+}
+
+func (s *Selector) Now() string {
+	return s.proxy().Name()
+}
+
+// Set switch the selected proxy by name
+func (s *Selector) Set(name string) error {
+	for _, proxy := range s.proxies {
+		if proxy.Name() == name {
+			s.mux.Lock()
+			s.selected = proxy
+			s.mux.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("proxy [%v] not exist in group [%v]", name, s.name)
+}
+
+func (s *Selector) proxy() ctx.Proxy {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.selected
+}
+
+func (s *Selector) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	return s.proxy().DialContext(ctx, metadata)
+}
+
+func (s *Selector) SupportUDP() bool {
+	return s.proxy().SupportUDP()
+}
+
+func (s *Selector) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	return s.proxy().ListenPacketContext(ctx, metadata)
+}
@@ -0,0 +1,65 @@
+package outboundgroup
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/tiechui1994/tcpover/ctx"
+)
+
+// URLTest select the proxy with lowest delay, the current proxy is kept
+// while its delay is within tolerance(ms) of the fastest.
+type URLTest struct {
+	*groupBase
+	tolerance uint16
+	mux       sync.Mutex
+	fastest   ctx.Proxy
+}
+
+func NewURLTest(option *GroupCommonOption, proxies []ctx.Proxy) *URLTest {
+	return &URLTest{
+		groupBase: &groupBase{
+			name:      option.Name,
+			proxyType: ctx.URLTest,
+			proxies:   proxies,
+			health:    NewHealthCheck(proxies, option.URL, option.interval()),
+		},
+		tolerance: uint16(option.Tolerance),
+	}
+}
+
+func (u *URLTest) Now() string {
+	return u.fast().Name()
+}
+
+func (u *URLTest) fast() ctx.Proxy {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	fastest := u.proxies[0]
+	minDelay := u.health.Delay(fastest.Name())
+	for _, proxy := range u.proxies[1:] {
+		if delay := u.health.Delay(proxy.Name()); delay < minDelay {
+			fastest, minDelay = proxy, delay
+		}
+	}
+
+	if u.fastest == nil || !u.health.Alive(u.fastest.Name()) ||
+		uint32(u.health.Delay(u.fastest.Name())) > uint32(minDelay)+uint32(u.tolerance) {
+		u.fastest = fastest
+	}
+	return u.fastest
+}
+
+func (u *URLTest) DialContext(ctx context.Context, metadata *ctx.Metadata) (net.Conn, error) {
+	return u.fast().DialContext(ctx, metadata)
+}
+
+func (u *URLTest) SupportUDP() bool {
+	return u.fast().SupportUDP()
+}
+
+func (u *URLTest) ListenPacketContext(ctx context.Context, metadata *ctx.Metadata) (net.PacketConn, error) {
+	return u.fast().ListenPacketContext(ctx, metadata)
+}
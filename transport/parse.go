@@ -2,9 +2,15 @@ package transport
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
 	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
 	"github.com/tiechui1994/tcpover/transport/common/structure"
 	"github.com/tiechui1994/tcpover/transport/outbound"
+	"github.com/tiechui1994/tcpover/transport/outboundgroup"
 )
 
 func ParseProxy(mapping map[string]interface{}) (ctx.Proxy, error) {
@@ -32,6 +38,27 @@ func ParseProxy(mapping map[string]interface{}) (ctx.Proxy, error) {
 			break
 		}
 		proxy, err = outbound.NewVless(*muxOption)
+	case ctx.Shadowsocks:
+		ssOption := &outbound.ShadowsocksOption{}
+		err = decoder.Decode(mapping, ssOption)
+		if err != nil {
+			break
+		}
+		proxy, err = outbound.NewShadowsocks(*ssOption)
+	case ctx.SSR:
+		ssrOption := &outbound.ShadowsocksROption{}
+		err = decoder.Decode(mapping, ssrOption)
+		if err != nil {
+			break
+		}
+		proxy, err = outbound.NewShadowsocksR(*ssrOption)
+	case ctx.AnyTLS:
+		anytlsOption := &outbound.AnyTLSOption{}
+		err = decoder.Decode(mapping, anytlsOption)
+		if err != nil {
+			break
+		}
+		proxy, err = outbound.NewAnyTLS(*anytlsOption)
 	case ctx.Direct:
 		proxy = outbound.NewDirect()
 	default:
@@ -40,3 +67,153 @@ func ParseProxy(mapping map[string]interface{}) (ctx.Proxy, error) {
 
 	return proxy, err
 }
+
+// ParseProxyGroup parse a proxy group, the member proxies must be registered
+func ParseProxyGroup(mapping map[string]interface{}) (ctx.Proxy, error) {
+	return outboundgroup.ParseProxyGroup(mapping, lookupProxy)
+}
+
+// ParseRule parse a rule line, eg: "DOMAIN-SUFFIX,google.com,proxy" or "MATCH,DIRECT".
+// The target of the rule must be a registered proxy.
+func ParseRule(line string) (rules.Rule, error) {
+	return parseRule(line, lookupProxy)
+}
+
+var applyMux sync.Mutex // serialize ApplyConfig
+
+// ApplyConfig parse proxies, proxy groups and rules, then replace the registered ones.
+// Nothing is changed when any of them is invalid. The proxy and group whose config is not
+// changed is reused, the replaced ones are closed.
+func ApplyConfig(proxyList, groupList []map[string]interface{}, ruleLines []string) (err error) {
+	applyMux.Lock()
+	defer applyMux.Unlock()
+
+	configMux.RLock()
+	oldProxies, oldConfigs := proxies, proxyConfigs
+	configMux.RUnlock()
+
+	newProxies := map[string]ctx.Proxy{}
+	newConfigs := map[string]map[string]interface{}{}
+	lookup := func(name string) (ctx.Proxy, bool) {
+		proxy, ok := newProxies[name]
+		return proxy, ok
+	}
+	// created is the proxy not reused, it is closed when it is overwritten or config is invalid
+	created := func(proxy ctx.Proxy) bool {
+		return oldProxies[proxy.Name()] != proxy
+	}
+	add := func(proxy ctx.Proxy, config map[string]interface{}) {
+		if exist, ok := newProxies[proxy.Name()]; ok && created(exist) {
+			_ = exist.Close()
+		}
+		newProxies[proxy.Name()] = proxy
+		newConfigs[proxy.Name()] = config
+	}
+	defer func() {
+		if err != nil {
+			for _, proxy := range newProxies {
+				if created(proxy) {
+					_ = proxy.Close()
+				}
+			}
+		}
+	}()
+
+	if direct, ok := oldProxies[outbound.NameDirect]; ok {
+		add(direct, nil)
+	} else {
+		add(outbound.NewDirect(), nil)
+	}
+
+	for _, v := range proxyList {
+		proxy, ok := reuseProxy(oldProxies, oldConfigs, v, lookup)
+		if !ok {
+			proxy, err = ParseProxy(v)
+			if err != nil {
+				return err
+			}
+		}
+		add(proxy, v)
+	}
+
+	for _, v := range groupList {
+		group, ok := reuseProxy(oldProxies, oldConfigs, v, lookup)
+		if !ok {
+			group, err = outboundgroup.ParseProxyGroup(v, lookup)
+			if err != nil {
+				return err
+			}
+		}
+		add(group, v)
+	}
+
+	newRules := make([]rules.Rule, 0, len(ruleLines))
+	for _, line := range ruleLines {
+		rule, err := parseRule(line, lookup)
+		if err != nil {
+			return err
+		}
+		newRules = append(newRules, rule)
+	}
+
+	configMux.Lock()
+	proxies = newProxies
+	proxyConfigs = newConfigs
+	ruleList = newRules
+	configMux.Unlock()
+
+	for name, proxy := range oldProxies {
+		if newProxies[name] != proxy {
+			_ = proxy.Close()
+		}
+	}
+	return nil
+}
+
+// reuseProxy return the registered proxy when its config is not changed. The group is reused
+// only if all of its member proxies are reused too.
+func reuseProxy(oldProxies map[string]ctx.Proxy, oldConfigs map[string]map[string]interface{},
+	config map[string]interface{}, lookup func(name string) (ctx.Proxy, bool)) (ctx.Proxy, bool) {
+	name, _ := config["name"].(string)
+	proxy, ok := oldProxies[name]
+	if !ok || !reflect.DeepEqual(oldConfigs[name], config) {
+		return nil, false
+	}
+	if group, ok := proxy.(outboundgroup.Group); ok {
+		for _, member := range group.Proxies() {
+			if current, ok := lookup(member.Name()); !ok || current != member {
+				return nil, false
+			}
+		}
+	}
+	return proxy, true
+}
+
+func parseRule(line string, lookup func(name string) (ctx.Proxy, bool)) (rules.Rule, error) {
+	items := strings.Split(line, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	var (
+		payload string
+		target  string
+		params  []string
+	)
+	switch l := len(items); {
+	case l == 2:
+		target = items[1]
+	case l >= 3:
+		payload = items[1]
+		target = items[2]
+		params = items[3:]
+	default:
+		return nil, fmt.Errorf("rule [%s] format invalid", line)
+	}
+
+	if _, ok := lookup(target); !ok {
+		return nil, fmt.Errorf("rule [%s] target proxy [%s] not found", line, target)
+	}
+
+	return rules.ParseRule(strings.ToUpper(items[0]), payload, target, params)
+}
@@ -0,0 +1,99 @@
+package statistic
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var DefaultManager *Manager
+
+func init() {
+	DefaultManager = &Manager{}
+	go DefaultManager.handle()
+}
+
+// Manager keep the alive connections and the traffic of them
+type Manager struct {
+	connections   sync.Map
+	uploadTemp    int64
+	downloadTemp  int64
+	uploadBlip    int64
+	downloadBlip  int64
+	uploadTotal   int64
+	downloadTotal int64
+}
+
+func (m *Manager) Join(c Tracker) {
+	m.connections.Store(c.ID(), c)
+}
+
+func (m *Manager) Leave(c Tracker) {
+	m.connections.Delete(c.ID())
+}
+
+func (m *Manager) Get(id string) (Tracker, bool) {
+	c, ok := m.connections.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return c.(Tracker), true
+}
+
+func (m *Manager) PushUploaded(size int64) {
+	atomic.AddInt64(&m.uploadTemp, size)
+	atomic.AddInt64(&m.uploadTotal, size)
+}
+
+func (m *Manager) PushDownloaded(size int64) {
+	atomic.AddInt64(&m.downloadTemp, size)
+	atomic.AddInt64(&m.downloadTotal, size)
+}
+
+// Now return the upload and download speed(bytes/s) of last second
+func (m *Manager) Now() (up int64, down int64) {
+	return atomic.LoadInt64(&m.uploadBlip), atomic.LoadInt64(&m.downloadBlip)
+}
+
+// Total return the upload and download bytes since started
+func (m *Manager) Total() (up int64, down int64) {
+	return atomic.LoadInt64(&m.uploadTotal), atomic.LoadInt64(&m.downloadTotal)
+}
+
+func (m *Manager) Snapshot() *Snapshot {
+	connections := make([]*TrackerInfo, 0)
+	m.connections.Range(func(key, value interface{}) bool {
+		connections = append(connections, value.(Tracker).Info())
+		return true
+	})
+
+	return &Snapshot{
+		UploadTotal:   atomic.LoadInt64(&m.uploadTotal),
+		DownloadTotal: atomic.LoadInt64(&m.downloadTotal),
+		Connections:   connections,
+	}
+}
+
+// CloseAll close all alive connections
+func (m *Manager) CloseAll() {
+	m.connections.Range(func(key, value interface{}) bool {
+		_ = value.(Tracker).Close()
+		return true
+	})
+}
+
+func (m *Manager) handle() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		atomic.StoreInt64(&m.uploadBlip, atomic.SwapInt64(&m.uploadTemp, 0))
+		atomic.StoreInt64(&m.downloadBlip, atomic.SwapInt64(&m.downloadTemp, 0))
+	}
+}
+
+type Snapshot struct {
+	DownloadTotal int64          `json:"downloadTotal"`
+	UploadTotal   int64          `json:"uploadTotal"`
+	Connections   []*TrackerInfo `json:"connections"`
+}
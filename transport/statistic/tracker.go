@@ -0,0 +1,178 @@
+package statistic
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/rules"
+)
+
+type Tracker interface {
+	ID() string
+	Close() error
+	Info() *TrackerInfo
+}
+
+type TrackerInfo struct {
+	UUID          string        `json:"id"`
+	Metadata      *ctx.Metadata `json:"metadata"`
+	UploadTotal   int64         `json:"upload"`
+	DownloadTotal int64         `json:"download"`
+	Start         time.Time     `json:"start"`
+	Chain         []string      `json:"chains"`
+	Rule          string        `json:"rule"`
+	RulePayload   string        `json:"rulePayload"`
+}
+
+// NewTrackerInfo return the info of connection which matched rule and dialed by proxy, rule and proxy can be nil.
+func NewTrackerInfo(metadata *ctx.Metadata, rule rules.Rule, proxy ctx.Proxy) *TrackerInfo {
+	info := &TrackerInfo{
+		UUID:     newID(),
+		Metadata: metadata,
+		Start:    time.Now(),
+		Chain:    chain(proxy),
+	}
+	if rule != nil {
+		info.Rule = rule.Name()
+		info.RulePayload = rule.Payload()
+	}
+	return info
+}
+
+func (t *TrackerInfo) snapshot() *TrackerInfo {
+	info := *t
+	info.UploadTotal = atomic.LoadInt64(&t.UploadTotal)
+	info.DownloadTotal = atomic.LoadInt64(&t.DownloadTotal)
+	return &info
+}
+
+// chain return the proxy names from the selected proxy to the outermost group
+func chain(proxy ctx.Proxy) []string {
+	if proxy == nil {
+		return nil
+	}
+
+	names := []string{proxy.Name()}
+	for {
+		group, ok := proxy.(ctx.ProxyGroup)
+		if !ok {
+			break
+		}
+		now := group.Now()
+		var next ctx.Proxy
+		for _, p := range group.Proxies() {
+			if p.Name() == now {
+				next = p
+				break
+			}
+		}
+		if next == nil {
+			break
+		}
+		names = append([]string{now}, names...)
+		proxy = next
+	}
+	return names
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+type tcpTracker struct {
+	net.Conn
+	info    *TrackerInfo
+	manager *Manager
+}
+
+// NewTCPTracker count the traffic of conn, read is download and write is upload.
+func NewTCPTracker(conn net.Conn, manager *Manager, info *TrackerInfo) net.Conn {
+	t := &tcpTracker{
+		Conn:    conn,
+		info:    info,
+		manager: manager,
+	}
+	manager.Join(t)
+	return t
+}
+
+func (t *tcpTracker) ID() string {
+	return t.info.UUID
+}
+
+func (t *tcpTracker) Info() *TrackerInfo {
+	return t.info.snapshot()
+}
+
+func (t *tcpTracker) Read(b []byte) (int, error) {
+	n, err := t.Conn.Read(b)
+	download := int64(n)
+	t.manager.PushDownloaded(download)
+	atomic.AddInt64(&t.info.DownloadTotal, download)
+	return n, err
+}
+
+func (t *tcpTracker) Write(b []byte) (int, error) {
+	n, err := t.Conn.Write(b)
+	upload := int64(n)
+	t.manager.PushUploaded(upload)
+	atomic.AddInt64(&t.info.UploadTotal, upload)
+	return n, err
+}
+
+func (t *tcpTracker) Close() error {
+	t.manager.Leave(t)
+	return t.Conn.Close()
+}
+
+type udpTracker struct {
+	net.PacketConn
+	info    *TrackerInfo
+	manager *Manager
+}
+
+// NewUDPTracker count the traffic of packet conn, read is download and write is upload.
+func NewUDPTracker(conn net.PacketConn, manager *Manager, info *TrackerInfo) net.PacketConn {
+	t := &udpTracker{
+		PacketConn: conn,
+		info:       info,
+		manager:    manager,
+	}
+	manager.Join(t)
+	return t
+}
+
+func (t *udpTracker) ID() string {
+	return t.info.UUID
+}
+
+func (t *udpTracker) Info() *TrackerInfo {
+	return t.info.snapshot()
+}
+
+func (t *udpTracker) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := t.PacketConn.ReadFrom(b)
+	download := int64(n)
+	t.manager.PushDownloaded(download)
+	atomic.AddInt64(&t.info.DownloadTotal, download)
+	return n, addr, err
+}
+
+func (t *udpTracker) WriteTo(b []byte, addr net.Addr) (int, error) {
+	n, err := t.PacketConn.WriteTo(b, addr)
+	upload := int64(n)
+	t.manager.PushUploaded(upload)
+	atomic.AddInt64(&t.info.UploadTotal, upload)
+	return n, err
+}
+
+func (t *udpTracker) Close() error {
+	t.manager.Leave(t)
+	return t.PacketConn.Close()
+}
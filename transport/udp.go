@@ -0,0 +1,127 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tiechui1994/tcpover/ctx"
+	"github.com/tiechui1994/tcpover/transport/common/pool"
+	"github.com/tiechui1994/tcpover/transport/statistic"
+)
+
+const (
+	udpTimeout = 60 * time.Second
+)
+
+type natEntry struct {
+	ready chan struct{}
+	pc    net.PacketConn
+}
+
+var (
+	natTable sync.Map // source-destination <=> *natEntry
+	udpIn    chan ctx.PacketAdapter
+)
+
+func init() {
+	udpIn = make(chan ctx.PacketAdapter, 200)
+	go func() {
+		for packet := range udpIn {
+			go handleUDPConn(packet)
+		}
+	}()
+}
+
+func writePacket(pc net.PacketConn, packet ctx.PacketAdapter) {
+	var addr net.Addr
+	if udpAddr := packet.Metadata().UDPAddr(); udpAddr != nil {
+		addr = udpAddr
+	}
+	if _, err := pc.WriteTo(packet.Data(), addr); err != nil {
+		logDebugln("[UDP] write to %s error: %s", packet.Metadata().RemoteAddress(), err)
+	}
+}
+
+func handleUDPConn(packet ctx.PacketAdapter) {
+	defer packet.Drop()
+
+	metadata := packet.Metadata()
+	if !metadata.Valid() {
+		logWarnln("[Metadata] not valid: %#v", metadata)
+		return
+	}
+
+	if err := preHandleMetadata(metadata); err != nil {
+		logDebugln("[Metadata PreHandle] error: %s", err)
+		return
+	}
+
+	key := metadata.SourceAddress() + "-" + metadata.RemoteAddress()
+	entry := &natEntry{ready: make(chan struct{})}
+	if actual, loaded := natTable.LoadOrStore(key, entry); loaded {
+		entry = actual.(*natEntry)
+		<-entry.ready
+		if entry.pc != nil {
+			writePacket(entry.pc, packet)
+		}
+		return
+	}
+
+	pc, err := listenPacket(metadata)
+	if err != nil {
+		natTable.Delete(key)
+		close(entry.ready)
+		return
+	}
+	entry.pc = pc
+	close(entry.ready)
+
+	go handleUDPToLocal(packet, pc, key)
+	writePacket(pc, packet)
+}
+
+func listenPacket(metadata *ctx.Metadata) (net.PacketConn, error) {
+	proxy, rule, err := resolveMetadata(metadata)
+	if err != nil {
+		logWarnln("[Metadata] parse failed: %s", err.Error())
+		return nil, err
+	}
+	if rule != nil {
+		logInfoln("[UDP] %s --> %s match %s(%s) using %s", metadata.SourceAddress(), metadata.RemoteAddress(), rule.Name(), rule.Payload(), proxy.Name())
+	} else {
+		logInfoln("[UDP] %s --> %s doesn't match any rule using %s", metadata.SourceAddress(), metadata.RemoteAddress(), proxy.Name())
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pc, err := proxy.ListenPacketContext(c, metadata)
+	if err != nil {
+		logWarnln("[UDP] dial %s --> %s error: %s", metadata.SourceAddress(), metadata.RemoteAddress(), err.Error())
+		return nil, err
+	}
+	return statistic.NewUDPTracker(pc, statistic.DefaultManager, statistic.NewTrackerInfo(metadata, rule, proxy)), nil
+}
+
+func handleUDPToLocal(packet ctx.UDPPacket, pc net.PacketConn, key string) {
+	buf := pool.Get(pool.UDPBufferSize)
+	defer func() {
+		_ = pc.Close()
+		natTable.Delete(key)
+		_ = pool.Put(buf)
+	}()
+
+	for {
+		_ = pc.SetReadDeadline(time.Now().Add(udpTimeout))
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		_, err = packet.WriteBack(buf[:n], from)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -92,14 +92,57 @@ func newConn(conn net.Conn, client *Client, dst *DstAddr) (*Conn, error) {
 	return c, nil
 }
 
+// Request is the vless request header read by server
+type Request struct {
+	UUID    [16]byte
+	User    string
+	Command byte
+	Addr    socks5.Addr
+}
+
+// Network return the network of request command
+func (r *Request) Network() string {
+	if r.Command == CommandUDP {
+		return "udp"
+	}
+	return "tcp"
+}
+
 func ReadAddr(conn net.Conn) (socks5.Addr, error) {
+	request, err := ReadRequest(conn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return request.Addr, nil
+}
+
+// ReadRequest read the request and reply, the uuid must be one of users when users is not nil.
+func ReadRequest(conn net.Conn, users *Users) (*Request, error) {
 	var err error
-	// version(1) id(16) addon(1) command(1)
-	buf := make([]byte, 1+16+1+1)
+	var request Request
+	// version(1) id(16) addon(1)
+	buf := make([]byte, 1+16+1)
 	_, err = io.ReadFull(conn, buf)
 	if err != nil {
 		return nil, err
 	}
+	copy(request.UUID[:], buf[1:17])
+	request.User, err = users.Lookup(request.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if length := int64(buf[17]); length != 0 {
+		_, err = io.CopyN(io.Discard, conn, length)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// command(1)
+	request.Command, err = socks5.ReadByte(conn)
+	if err != nil {
+		return nil, err
+	}
 
 	// port(2) addrType(1)
 	buf = make([]byte, 2+1)
@@ -156,5 +199,6 @@ func ReadAddr(conn net.Conn) (socks5.Addr, error) {
 		return nil, err
 	}
 
-	return addr, nil
+	request.Addr = addr
+	return &request, nil
 }
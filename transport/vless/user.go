@@ -0,0 +1,37 @@
+package vless
+
+import (
+	"errors"
+)
+
+var ErrInvalidUser = errors.New("invalid vless user")
+
+// Users is the allowed accounts of server, nil Users accept any uuid
+type Users struct {
+	users map[UUID]string
+}
+
+// NewUsers return Users of name => uuid, the uuid which is not standard format is mapped by UUIDMap
+func NewUsers(accounts map[string]string) (*Users, error) {
+	users := &Users{users: make(map[UUID]string, len(accounts))}
+	for name, id := range accounts {
+		if id == "" {
+			return nil, errors.New("empty uuid of vless user " + name)
+		}
+		uid, _ := UUIDMap(id)
+		users.users[uid] = name
+	}
+	return users, nil
+}
+
+// Lookup return the user name of id
+func (u *Users) Lookup(id UUID) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	name, ok := u.users[id]
+	if !ok {
+		return "", ErrInvalidUser
+	}
+	return name, nil
+}
@@ -1,7 +1,9 @@
 package vless
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"hash"
@@ -101,6 +103,21 @@ func (u UUID) Bytes() []byte {
 	return u[:]
 }
 
+// String returns the canonical string representation of the UUID.
+func (u UUID) String() string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf)
+}
+
 // SetVersion sets the version bits.
 func (u *UUID) SetVersion(v byte) {
 	u[6] = (u[6] & 0x0f) | (v << 4)
@@ -140,6 +157,18 @@ func newFromHash(h hash.Hash, ns UUID, name string) UUID {
 	return u
 }
 
+// NewV4 returns a random generated UUID.
+func NewV4() (UUID, error) {
+	u := UUID{}
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	u.SetVersion(V4)
+	u.SetVariant(VariantRFC4122)
+
+	return u, nil
+}
+
 func NewV5(ns UUID, name string) UUID {
 	u := newFromHash(sha1.New(), ns, name)
 	u.SetVersion(V5)
@@ -2,26 +2,77 @@ package wless
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"strconv"
+	"sync"
+	"syscall"
 
+	"github.com/tiechui1994/tcpover/ctx"
 	"github.com/tiechui1994/tcpover/transport/socks5"
 )
 
-type Conn struct {
-	net.Conn
-	addr     string
-	received bool
+const (
+	Version1 byte = 1
+	Version2 byte = 2 // request with response status
+)
+
+const (
+	StatusSuccess byte = iota
+	StatusError
+	StatusHostUnreachable
+	StatusConnectionRefused
+	StatusTimeout
+	StatusForbidden
+)
+
+// ErrForbidden is the error of target which is not allowed to connect
+var ErrForbidden = ctx.ErrForbidden
+
+// ResponseError is the failure status of Wless v2 handshake
+type ResponseError struct {
+	Status  byte
+	Message string
 }
 
-func (vc *Conn) Read(b []byte) (int, error) {
-	return vc.Conn.Read(b)
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("remote %v: %v", StatusText(e.Status), e.Message)
+}
+
+// StatusText return the text of failure status
+func StatusText(status byte) string {
+	switch status {
+	case StatusSuccess:
+		return "success"
+	case StatusHostUnreachable:
+		return "host unreachable"
+	case StatusConnectionRefused:
+		return "connection refused"
+	case StatusTimeout:
+		return "timeout"
+	case StatusForbidden:
+		return "forbidden"
+	default:
+		return "error"
+	}
+}
+
+type Conn struct {
+	net.Conn
+	addr    string
+	version byte
 }
 
 func (vc *Conn) sendRequest() error {
 	buf := &bytes.Buffer{}
 
+	// v2: 0x00(1) + version(1) + length(1) + N, zero length is invalid in v1
+	if vc.version >= Version2 {
+		buf.WriteByte(0)
+		buf.WriteByte(vc.version)
+	}
 	buf.WriteByte(byte(len(vc.addr)))
 	buf.Write([]byte(vc.addr))
 
@@ -29,26 +80,70 @@ func (vc *Conn) sendRequest() error {
 	return err
 }
 
-// newConn return a Conn instance
-func newConn(conn net.Conn, dst string) (*Conn, error) {
+func (vc *Conn) recvResponse() error {
+	// status(1) + length(1) + message(N)
+	buf := make([]byte, 2)
+	_, err := io.ReadFull(vc.Conn, buf)
+	if err != nil {
+		return err
+	}
+
+	message := make([]byte, int(buf[1]))
+	_, err = io.ReadFull(vc.Conn, message)
+	if err != nil {
+		return err
+	}
+	if buf[0] != StatusSuccess {
+		return &ResponseError{Status: buf[0], Message: string(message)}
+	}
+	return nil
+}
+
+// newConn return a Conn instance, the response of v2 is read before return so that dial error
+// reach the caller. conn is closed on failure.
+func newConn(conn net.Conn, dst string, version byte) (*Conn, error) {
 	c := &Conn{
-		Conn: conn,
-		addr: dst,
+		Conn:    conn,
+		addr:    dst,
+		version: version,
 	}
 
 	if err := c.sendRequest(); err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
+	if version >= Version2 {
+		if err := c.recvResponse(); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
 	return c, nil
 }
 
-func ReadAddr(conn net.Conn) (addr socks5.Addr, err error) {
-	// length(1) + N
-	var length byte
-	length, err = socks5.ReadByte(conn)
+type Request struct {
+	Version byte
+	Addr    socks5.Addr
+}
+
+func ReadRequest(conn net.Conn) (*Request, error) {
+	// v1: length(1) + N
+	// v2: 0x00(1) + version(1) + length(1) + N
+	request := &Request{Version: Version1}
+	length, err := socks5.ReadByte(conn)
 	if err != nil {
 		return nil, err
 	}
+	if length == 0 {
+		request.Version, err = socks5.ReadByte(conn)
+		if err != nil {
+			return nil, err
+		}
+		length, err = socks5.ReadByte(conn)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	buf := make([]byte, int(length))
 	_, err = io.ReadFull(conn, buf)
@@ -70,6 +165,77 @@ func ReadAddr(conn net.Conn) (addr socks5.Addr, err error) {
 	copy(b[2:2+len(host)], host)
 	b[2+len(host)] = uint8(port >> 8)
 	b[2+len(host)+1] = uint8(port)
+	request.Addr = b
+
+	return request, nil
+}
+
+func ReadAddr(conn net.Conn) (addr socks5.Addr, err error) {
+	request, err := ReadRequest(conn)
+	if err != nil {
+		return nil, err
+	}
+	return request.Addr, nil
+}
+
+// WriteResponse write the status of err to client, the message is truncated to 255 bytes
+func WriteResponse(w io.Writer, err error) error {
+	status, message := StatusSuccess, ""
+	if err != nil {
+		status, message = ErrorStatus(err), err.Error()
+	}
+	if len(message) > 255 {
+		message = message[:255]
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(status)
+	buf.WriteByte(byte(len(message)))
+	buf.WriteString(message)
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// ErrorStatus return the status of dial error
+func ErrorStatus(err error) byte {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return StatusForbidden
+	case errors.As(err, &dnsErr), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return StatusHostUnreachable
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return StatusConnectionRefused
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return StatusTimeout
+	default:
+		return StatusError
+	}
+}
+
+// serverConn report the dial result of v2 request to client
+type serverConn struct {
+	net.Conn
+	once sync.Once
+}
+
+// NewServerConn wrap conn to report handshake result, v1 conn is returned as it is.
+func NewServerConn(conn net.Conn, version byte) net.Conn {
+	if version < Version2 {
+		return conn
+	}
+	return &serverConn{Conn: conn}
+}
+
+func (c *serverConn) HandshakeSuccess() error {
+	return c.HandshakeFailure(nil)
+}
 
-	return b, nil
+func (c *serverConn) HandshakeFailure(err error) error {
+	var writeErr error
+	c.once.Do(func() {
+		writeErr = WriteResponse(c.Conn, err)
+	})
+	return writeErr
 }
@@ -4,14 +4,15 @@ import "net"
 
 // Client is wless connection generator
 type Client struct {
+	Version byte
 }
 
 // StreamConn return a Conn with net.Conn and DstAddr
 func (c *Client) StreamConn(conn net.Conn, dst string) (net.Conn, error) {
-	return newConn(conn, dst)
+	return newConn(conn, dst, c.Version)
 }
 
 // NewClient return Client instance
-func NewClient() *Client{
-	return &Client{}
+func NewClient() *Client {
+	return &Client{Version: Version1}
 }
@@ -0,0 +1,181 @@
+package wss
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthMaxSkew is the max time difference between the signed timestamp and server
+const AuthMaxSkew = 5 * time.Minute
+
+// header of credential, they are not sent in url query which may be logged by proxy
+const (
+	HeaderAuthUser  = "X-Auth-User"
+	HeaderAuthToken = "X-Auth-Token"
+	HeaderAuthTs    = "X-Auth-Ts"
+	HeaderAuthNonce = "X-Auth-Nonce"
+	HeaderAuthSign  = "X-Auth-Sign"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrExpired      = errors.New("signature expired")
+	ErrReplayed     = errors.New("signature replayed")
+)
+
+// Auth is the credential of client. Token is sent as it is, Secret is used to sign the
+// connect params with HMAC-SHA256 and never leaves the client.
+type Auth struct {
+	User   string
+	Token  string
+	Secret string
+}
+
+func (a *Auth) encode(header http.Header, query url.Values) {
+	if a == nil || a.User == "" {
+		return
+	}
+
+	header.Set(HeaderAuthUser, a.User)
+	if a.Token != "" {
+		header.Set(HeaderAuthToken, a.Token)
+	}
+	if a.Secret != "" {
+		nonce := make([]byte, 16)
+		_, _ = rand.Read(nonce)
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set(HeaderAuthTs, ts)
+		header.Set(HeaderAuthNonce, hex.EncodeToString(nonce))
+		header.Set(HeaderAuthSign, Sign(a.Secret, header, query))
+	}
+}
+
+// Sign return the HMAC-SHA256 of user, ts and nonce in header, and name, code, mode, rule,
+// network and service in query
+func Sign(secret string, header http.Header, query url.Values) string {
+	values := []string{header.Get(HeaderAuthUser), header.Get(HeaderAuthTs), header.Get(HeaderAuthNonce)}
+	for _, k := range []string{"name", "code", "mode", "rule", "network", "service"} {
+		values = append(values, query.Get(k))
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(values, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Authenticator check websocket request and return the user name
+type Authenticator interface {
+	Authenticate(r *http.Request) (string, error)
+	// AllowAgent check the user can register agent with name
+	AllowAgent(user, name string) bool
+}
+
+type User struct {
+	Name   string
+	Token  string
+	Secret string
+	Agents []string // agent names the user can register, empty allow any name
+}
+
+type userAuthenticator struct {
+	users map[string]User
+
+	mux       sync.Mutex
+	nonces    map[string]time.Time // nonce <=> signed time, used nonce is rejected
+	lastPrune time.Time
+}
+
+func NewAuthenticator(users []User) Authenticator {
+	auth := &userAuthenticator{
+		users:  make(map[string]User, len(users)),
+		nonces: map[string]time.Time{},
+	}
+	for _, user := range users {
+		auth.users[user.Name] = user
+	}
+	return auth
+}
+
+func (a *userAuthenticator) Authenticate(r *http.Request) (string, error) {
+	user, ok := a.users[r.Header.Get(HeaderAuthUser)]
+	if !ok {
+		return "", ErrUnauthorized
+	}
+
+	if user.Token != "" {
+		if subtle.ConstantTimeCompare([]byte(user.Token), []byte(r.Header.Get(HeaderAuthToken))) == 1 {
+			return user.Name, nil
+		}
+	}
+
+	if sign := r.Header.Get(HeaderAuthSign); user.Secret != "" && sign != "" {
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderAuthTs), 10, 64)
+		if err != nil {
+			return "", ErrUnauthorized
+		}
+		signed := time.Unix(ts, 0)
+		skew := time.Since(signed)
+		if skew > AuthMaxSkew || skew < -AuthMaxSkew {
+			return "", ErrExpired
+		}
+		if !hmac.Equal([]byte(Sign(user.Secret, r.Header, r.URL.Query())), []byte(sign)) {
+			return "", ErrUnauthorized
+		}
+		if !a.useNonce(r.Header.Get(HeaderAuthNonce), signed) {
+			return "", ErrReplayed
+		}
+		return user.Name, nil
+	}
+
+	return "", ErrUnauthorized
+}
+
+// useNonce record the nonce, false if it is empty or used. The nonce is kept until the signature expired.
+func (a *userAuthenticator) useNonce(nonce string, signed time.Time) bool {
+	if nonce == "" {
+		return false
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastPrune) > time.Minute {
+		for k, t := range a.nonces {
+			if now.Sub(t) > AuthMaxSkew {
+				delete(a.nonces, k)
+			}
+		}
+		a.lastPrune = now
+	}
+	if _, ok := a.nonces[nonce]; ok {
+		return false
+	}
+	a.nonces[nonce] = signed
+	return true
+}
+
+func (a *userAuthenticator) AllowAgent(user, name string) bool {
+	u, ok := a.users[user]
+	if !ok {
+		return false
+	}
+	if len(u.Agents) == 0 {
+		return true
+	}
+	for _, v := range u.Agents {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
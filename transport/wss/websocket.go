@@ -55,12 +55,18 @@ func (m *Mode) Mux() Mode {
 	return ModeForwardMux
 }
 
+// Version is sent to server with header "X-Version"
+var Version string
+
 type ConnectParam struct {
-	Name   string
-	Role   string
-	Code   string
-	Mode   Mode
-	Header http.Header
+	Name    string
+	Role    string
+	Code    string
+	Mode    Mode
+	Network string
+	Service string // published service of agent, the conn is raw data of service
+	Header  http.Header
+	Auth    *Auth
 }
 
 var (
@@ -97,8 +103,10 @@ func WebSocketConnect(ctx context.Context, server string, param *ConnectParam) (
 }
 
 func RawWebSocketConnect(ctx context.Context, server string, param *ConnectParam) (*websocket.Conn, error) {
-	if param.Header == nil {
-		param.Header = http.Header{}
+	// header is shared by connections of proxy, credential is set on the copy
+	header := param.Header.Clone()
+	if header == nil {
+		header = http.Header{}
 	}
 
 	query := url.Values{}
@@ -108,8 +116,18 @@ func RawWebSocketConnect(ctx context.Context, server string, param *ConnectParam
 	if param.Role != "" {
 		query.Set("rule", param.Role)
 	}
+	if param.Network != "" {
+		query.Set("network", param.Network)
+	}
+	if param.Service != "" {
+		query.Set("service", param.Service)
+	}
+	param.Auth.encode(header, query)
+	if Version != "" && header.Get("X-Version") == "" {
+		header.Set("X-Version", Version)
+	}
 	u := server + "?" + query.Encode()
-	conn, resp, err := dialer.DialContext(ctx, u, param.Header)
+	conn, resp, err := dialer.DialContext(ctx, u, header)
 	if err != nil {
 		return nil, err
 	}